@@ -0,0 +1,483 @@
+package goseq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	BulkPeerBusy error = errors.New("Another bulk query to this server is in progress.")
+)
+
+// BulkQuery selects which queries a Bulk sends to each server.
+type BulkQuery byte
+
+const (
+	BulkInfo BulkQuery = 1 << iota
+	BulkPlayers
+	BulkRules
+)
+
+// Bulk queries many servers at once from a handful of shared UDP
+// sockets, instead of dialing a socket for every query. Replies are
+// handed to the query waiting on their source address, which takes
+// care of challenges and split packets like Server does.
+//
+// Only IPv4 servers can be queried, which is all the masters list.
+// A Bulk is safe for concurrent use; a server that is already being
+// queried through it fails with BulkPeerBusy.
+type Bulk struct {
+	opts    BulkOptions
+	sockets []*bulkSocket
+	limiter *packetLimiter
+}
+
+// BulkOptions tunes a Bulk. Zero fields fall back to
+// DefaultBulkOptions.
+type BulkOptions struct {
+	// Sockets is how many UDP sockets to spread the servers over.
+	Sockets int
+	// MaxInFlight is how many servers are queried at once. Each
+	// has at most one request awaiting a reply.
+	MaxInFlight int
+	// PacketsPerSecond caps the requests sent over all sockets.
+	PacketsPerSecond int
+	// Timeout bounds all the queries made to one server.
+	Timeout time.Duration
+	// Queries are sent in the order info, players, rules;
+	// the first to fail ends the server's queries.
+	Queries BulkQuery
+	// Limits caps what a response may make us allocate.
+	Limits Limits
+	// Retry applies to each query on its own, within Timeout.
+	Retry RetryPolicy
+}
+
+var (
+	DefaultBulkOptions BulkOptions = BulkOptions{
+		Sockets:          1,
+		MaxInFlight:      256,
+		PacketsPerSecond: 1000,
+		Timeout:          5 * time.Second,
+		Queries:          BulkInfo,
+	}
+)
+
+func (o BulkOptions) orDefault() BulkOptions {
+	if o.Sockets <= 0 {
+		o.Sockets = DefaultBulkOptions.Sockets
+	}
+	if o.MaxInFlight <= 0 {
+		o.MaxInFlight = DefaultBulkOptions.MaxInFlight
+	}
+	if o.PacketsPerSecond <= 0 {
+		o.PacketsPerSecond = DefaultBulkOptions.PacketsPerSecond
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultBulkOptions.Timeout
+	}
+	if o.Queries == 0 {
+		o.Queries = DefaultBulkOptions.Queries
+	}
+	return o
+}
+
+// BulkResult is what was learnt about one server. Err is the
+// *QueryError of the query that failed, if one did; the results
+// of the queries before it are kept.
+type BulkResult struct {
+	ServerState
+	// Attempts counts the requests made over all queries,
+	// retries included, but not challenges.
+	Attempts int
+	Err      error
+}
+
+// NewBulk opens the sockets of a Bulk. Close it when done.
+func NewBulk(opts BulkOptions) (*Bulk, error) {
+	opts = opts.orDefault()
+	b := &Bulk{
+		opts:    opts,
+		limiter: newPacketLimiter(opts.PacketsPerSecond),
+	}
+
+	for i := 0; i < opts.Sockets; i++ {
+		conn, err := net.ListenUDP("udp4", nil)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		sock := &bulkSocket{conn: conn, limiter: b.limiter, peers: map[netip.AddrPort]*muxConn{}}
+		b.sockets = append(b.sockets, sock)
+		go sock.demux()
+	}
+	return b, nil
+}
+
+// Close closes the sockets. Queries still running fail.
+func (b *Bulk) Close() error {
+	b.limiter.stop()
+	var errs []error
+	for _, sock := range b.sockets {
+		errs = append(errs, sock.conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Query queries every server in addrs. See QueryStream.
+func (b *Bulk) Query(ctx context.Context, addrs []string) <-chan BulkResult {
+	in := make(chan string)
+	go func() {
+		defer close(in)
+		for _, addr := range addrs {
+			select {
+			case in <- addr:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return b.QueryStream(ctx, in)
+}
+
+// QueryStream queries the servers read from addrs as they come,
+// for instance from a master crawl, and delivers a result for each
+// in the order they finish. Addresses seen before are skipped. The
+// channel is unbuffered, and is closed once addrs is closed and
+// every result has been delivered, or as soon as ctx is done.
+//
+// A result counts against MaxInFlight until it has been received,
+// so no more than that many queries run or wait to be delivered.
+func (b *Bulk) QueryStream(ctx context.Context, addrs <-chan string) <-chan BulkResult {
+	out := make(chan BulkResult)
+	go func() {
+		defer close(out)
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		slots := make(chan struct{}, b.opts.MaxInFlight)
+		seen := map[string]bool{}
+		for {
+			var addr string
+			var ok bool
+			select {
+			case addr, ok = <-addrs:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// the slot is held until the result is taken, so
+				// that a slow reader holds back new queries
+				defer func() { <-slots }()
+				result := b.query(ctx, addr)
+				select {
+				case out <- result:
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}()
+	return out
+}
+
+// query runs the selected queries against one server.
+func (b *Bulk) query(ctx context.Context, addr string) BulkResult {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+
+	serv := &iserver{
+		src:         &bulkSource{bulk: b, addr: addr},
+		limits:      b.opts.Limits,
+		retryPolicy: b.opts.Retry,
+	}
+	result := BulkResult{ServerState: ServerState{Address: addr}}
+
+	// the queries run one after the other,
+	// each filling in the report afresh
+	report := &QueryReport{}
+	ctx = WithQueryReport(ctx, report)
+
+	if b.opts.Queries&BulkInfo != 0 {
+		info, err := serv.InfoContext(ctx)
+		result.Attempts += report.Attempts
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Info = &info
+	}
+	if b.opts.Queries&BulkPlayers != 0 {
+		result.Players, result.Err = serv.PlayersContext(ctx)
+		result.Attempts += report.Attempts
+		if result.Err != nil {
+			return result
+		}
+	}
+	if b.opts.Queries&BulkRules != 0 {
+		result.Rules, result.Err = serv.RulesContext(ctx)
+		result.Attempts += report.Attempts
+	}
+	return result
+}
+
+// socket picks the socket for peer. A peer always gets the
+// same one, so that it can only be queried once at a time.
+func (b *Bulk) socket(peer netip.AddrPort) *bulkSocket {
+	h := fnv.New32a()
+	h.Write(peer.Addr().AsSlice())
+	binary.Write(h, binary.BigEndian, peer.Port())
+	return b.sockets[h.Sum32()%uint32(len(b.sockets))]
+}
+
+// bulkSource hands out connections to one server
+// multiplexed over the sockets of a Bulk.
+type bulkSource struct {
+	bulk *Bulk
+	addr string
+	// what the earlier queries to addr were after
+	requests requestLog
+}
+
+func (s *bulkSource) address() string { return s.addr }
+
+func (s *bulkSource) setAddress(a string) error {
+	s.addr = a
+	return nil
+}
+
+func (s *bulkSource) connection() (net.Conn, error) {
+	if s.addr == NoAddress || s.addr == "" {
+		return nil, NoAddressSet
+	}
+	remote, err := net.ResolveUDPAddr("udp4", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	peer := remote.AddrPort()
+	peer = netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())
+	return s.bulk.socket(peer).register(peer, remote, &s.requests)
+}
+
+// bulkSocket is one shared socket and the peers
+// currently waiting for replies on it.
+type bulkSocket struct {
+	conn    *net.UDPConn
+	limiter *packetLimiter
+
+	mu     sync.Mutex
+	peers  map[netip.AddrPort]*muxConn
+	closed bool
+}
+
+// muxInbox is how many datagrams a peer may have waiting to be
+// read; a split response rarely has more parts in flight.
+const muxInbox = 32
+
+func (s *bulkSocket) register(peer netip.AddrPort, remote *net.UDPAddr, requests *requestLog) (*muxConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, net.ErrClosed
+	}
+	if _, busy := s.peers[peer]; busy {
+		return nil, BulkPeerBusy
+	}
+
+	c := &muxConn{
+		sock:     s,
+		peer:     peer,
+		remote:   remote,
+		inbox:    make(chan []byte, muxInbox),
+		requests: requests,
+		wake:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	s.peers[peer] = c
+	return c, nil
+}
+
+func (s *bulkSocket) unregister(c *muxConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peers[c.peer] == c {
+		delete(s.peers, c.peer)
+	}
+}
+
+// demux hands each datagram to the peer it came from, until the
+// socket is closed. Datagrams nobody waits for are dropped, as are
+// those of a peer that doesn't keep up.
+func (s *bulkSocket) demux() {
+	buffer := make([]byte, MaxDatagramSize+1)
+	for {
+		n, from, err := s.conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.shutdown()
+				return
+			}
+			continue
+		}
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+
+		s.mu.Lock()
+		c := s.peers[from]
+		s.mu.Unlock()
+		if c == nil {
+			continue
+		}
+
+		select {
+		case c.inbox <- append([]byte(nil), buffer[0:n]...):
+		default:
+		}
+	}
+}
+
+func (s *bulkSocket) shutdown() {
+	s.mu.Lock()
+	peers := s.peers
+	s.peers = map[netip.AddrPort]*muxConn{}
+	s.closed = true
+	s.mu.Unlock()
+
+	for _, c := range peers {
+		c.Close()
+	}
+}
+
+// muxConn is a net.Conn to one peer over a shared socket.
+type muxConn struct {
+	sock   *bulkSocket
+	peer   netip.AddrPort
+	remote *net.UDPAddr
+	inbox  chan []byte
+	// shared by the queries of one bulk result
+	requests *requestLog
+
+	mu       sync.Mutex
+	deadline time.Time
+	// closed and replaced whenever the deadline changes,
+	// to wake up blocked calls
+	wake chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *muxConn) Read(b []byte) (int, error) {
+	for {
+		timeout, wake, stop := c.waitDeadline()
+		select {
+		case data := <-c.inbox:
+			stop()
+			return copy(b, data), nil
+		case <-c.closed:
+			stop()
+			return 0, net.ErrClosed
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-wake:
+			stop()
+		}
+	}
+}
+
+func (c *muxConn) Write(b []byte) (int, error) {
+	for {
+		timeout, wake, stop := c.waitDeadline()
+		select {
+		case <-c.sock.limiter.next():
+			stop()
+			return c.sock.conn.WriteToUDPAddrPort(b, c.peer)
+		case <-c.closed:
+			stop()
+			return 0, net.ErrClosed
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-wake:
+			stop()
+		}
+	}
+}
+
+// waitDeadline returns a channel that fires at the deadline, nil if
+// there is none, a channel closed when the deadline changes, and a
+// function to release the timer.
+func (c *muxConn) waitDeadline() (<-chan time.Time, <-chan struct{}, func()) {
+	c.mu.Lock()
+	deadline, wake := c.deadline, c.wake
+	c.mu.Unlock()
+
+	if deadline.IsZero() {
+		return nil, wake, func() {}
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	return timer.C, wake, func() { timer.Stop() }
+}
+
+func (c *muxConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.sock.unregister(c)
+	})
+	return nil
+}
+
+func (c *muxConn) expect(want []byte)    { c.requests.expect(want) }
+func (c *muxConn) late(header byte) bool { return c.requests.late(header) }
+
+func (c *muxConn) LocalAddr() net.Addr  { return c.sock.conn.LocalAddr() }
+func (c *muxConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *muxConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.wake)
+	c.wake = make(chan struct{})
+	return nil
+}
+
+func (c *muxConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *muxConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// packetLimiter hands out send slots at a steady rate.
+// Slots nobody takes are lost, so there are no bursts.
+type packetLimiter struct {
+	ticker *time.Ticker
+}
+
+func newPacketLimiter(perSecond int) *packetLimiter {
+	interval := max(time.Second/time.Duration(perSecond), time.Nanosecond)
+	return &packetLimiter{ticker: time.NewTicker(interval)}
+}
+
+// next returns a channel that yields once the next packet may be sent.
+func (l *packetLimiter) next() <-chan time.Time { return l.ticker.C }
+
+func (l *packetLimiter) stop() { l.ticker.Stop() }
@@ -0,0 +1,202 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBulkResponder challenges every request without challenge 555
+// and sends players split into small packets.
+func testBulkResponder(t *testing.T) *testResponder {
+	return newTestResponder(t, func(req []byte) [][]byte {
+		var got int32
+		if len(req) < 9 || binary.Read(bytes.NewBuffer(req[len(req)-4:]), byteOrder, &got) != nil {
+			return nil
+		}
+		if got != 555 {
+			return [][]byte{testChallengeResponse(555)}
+		}
+		switch req[4] {
+		case tInfoPacketReqID:
+			return [][]byte{testInfoResponse()}
+		case tPlayersPacketReqID:
+			return testSplitSource(7, testPlayersResponse(), 10)
+		case tRulesPacketReqID:
+			return [][]byte{testRulesResponse()}
+		}
+		return nil
+	})
+}
+
+func TestBulk_Query(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 20; i++ {
+		addrs = append(addrs, testBulkResponder(t).Address())
+	}
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+	addrs = append(addrs, silent.Address(), addrs[0])
+
+	b, err := NewBulk(BulkOptions{
+		Sockets:     2,
+		MaxInFlight: 4,
+		Timeout:     200 * time.Millisecond,
+		Queries:     BulkInfo | BulkPlayers | BulkRules,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var answered []string
+	for result := range b.Query(context.Background(), addrs) {
+		if result.Address == silent.Address() {
+			if !errors.Is(result.Err, Timeout) {
+				t.Log("Expected the silent server to time out, got", result.Err)
+				t.FailNow()
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Log("Unexpected error from", result.Address, ":", result.Err)
+			t.FailNow()
+		}
+		checkTestInfo(t, *result.Info)
+		if len(result.Players) != 2 || result.Players[1].Name() != "bob" || result.Rules["sv_cheats"] != "0" {
+			t.Log("Unexpected result:", result.Players, result.Rules)
+			t.FailNow()
+		}
+		answered = append(answered, result.Address)
+	}
+
+	// the duplicate is only queried once
+	sort.Strings(answered)
+	expected := append([]string(nil), addrs[0:20]...)
+	sort.Strings(expected)
+	if len(answered) != len(expected) {
+		t.Log("Expected", len(expected), "answers, got", len(answered))
+		t.FailNow()
+	}
+	for i := range expected {
+		if answered[i] != expected[i] {
+			t.Log("Expected answers from", expected, "got", answered)
+			t.FailNow()
+		}
+	}
+}
+
+func TestBulk_packetsPerSecond(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 5; i++ {
+		addrs = append(addrs, testBulkResponder(t).Address())
+	}
+
+	// 5 servers take 2 requests each to get info
+	b, err := NewBulk(BulkOptions{PacketsPerSecond: 50, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	start := time.Now()
+	for result := range b.Query(context.Background(), addrs) {
+		if result.Err != nil {
+			t.Log("Unexpected error:", result.Err)
+			t.FailNow()
+		}
+	}
+	if took := time.Since(start); took < 180*time.Millisecond {
+		t.Log("Expected 10 packets at 50/s to take 200ms, took", took)
+		t.FailNow()
+	}
+}
+
+func TestBulk_peerBusy(t *testing.T) {
+	r := testBulkResponder(t)
+	b, err := NewBulk(BulkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	src := &bulkSource{bulk: b, addr: r.Address()}
+	conn, err := src.connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.connection(); err != BulkPeerBusy {
+		t.Log("Expected BulkPeerBusy, got", err)
+		t.FailNow()
+	}
+	conn.Close()
+	if conn, err = src.connection(); err != nil {
+		t.Log("Expected the peer to be free again, got", err)
+		t.FailNow()
+	}
+	conn.Close()
+}
+
+func TestBulk_cancel(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+	b, err := NewBulk(BulkOptions{Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	for range b.Query(ctx, []string{silent.Address()}) {
+	}
+	if time.Since(start) > time.Second {
+		t.Log("Query did not stop when cancelled.")
+		t.FailNow()
+	}
+}
+
+func TestBulk_backPressure(t *testing.T) {
+	var queried atomic.Int32
+	var addrs []string
+	for i := 0; i < 10; i++ {
+		r := newTestResponder(t, func([]byte) [][]byte {
+			queried.Add(1)
+			return [][]byte{testInfoResponse()}
+		})
+		addrs = append(addrs, r.Address())
+	}
+
+	b, err := NewBulk(BulkOptions{MaxInFlight: 2, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	results := b.Query(context.Background(), addrs)
+
+	// nobody reads the results yet
+	time.Sleep(200 * time.Millisecond)
+	if n := queried.Load(); n > 2 {
+		t.Log("Expected at most 2 servers queried before any result was read, got", n)
+		t.FailNow()
+	}
+
+	got := 0
+	for result := range results {
+		if result.Err != nil {
+			t.Log("Unexpected error:", result.Err)
+			t.FailNow()
+		}
+		got++
+	}
+	if got != len(addrs) {
+		t.Log("Expected", len(addrs), "results, got", got)
+		t.FailNow()
+	}
+}
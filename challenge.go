@@ -2,52 +2,164 @@ package goseq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"net"
 )
 
 var ChallengeFailed error = errors.New("Could not retrieve challenge.")
 var ChallengeSizeMismatch error = errors.New("Challenge was the wrong size.")
 
-func (s *iserver) getChallenge(rqtype byte) (ch int32, err error) {
+// maxChallengeRounds bounds how many challenges a server may hand
+// out for a single request before we give up on it.
+const maxChallengeRounds = 3
+
+// HandshakePath describes how a server answered a request that
+// may require a challenge (A2S_INFO, A2S_PLAYER and A2S_RULES).
+type HandshakePath byte
+
+const (
+	// HandshakeNone means no challenged request has completed yet.
+	HandshakeNone HandshakePath = iota
+	// HandshakeDirect means the server sent the payload straight away.
+	HandshakeDirect
+	// HandshakeChallenged means the server demanded one challenge.
+	HandshakeChallenged
+	// HandshakeRechallenged means the server handed out more than
+	// one challenge before answering.
+	HandshakeRechallenged
+	// HandshakeCached means the server accepted a challenge
+	// remembered from an earlier query.
+	HandshakeCached
+)
 
-	buf := bytes.NewBuffer([]byte{0xFF, 0xFF, 0xFF, 0xFF})
-	binary.Write(buf, byteOrder, challenge{
-		Type:      rqtype,
-		Challenge: -1,
-	})
+// challengeCache is implemented by connections that remember
+// the challenge their server handed out, see Session.
+type challengeCache interface {
+	cachedChallenge() (int32, bool)
+	storeChallenge(int32)
+}
 
-	conn, err := s.getConnection()
-	if err != nil {
-		return
-	}
+// lateReplies is implemented by connections that outlive a single
+// query, on which replies to an earlier query may still turn up.
+type lateReplies interface {
+	// expect records the response headers a query is after.
+	expect(want []byte)
+	// late reports whether header answers a request
+	// an earlier query sent.
+	late(header byte) bool
+}
 
-	chRequest := buf.Bytes()
+// requestLog implements lateReplies for a socket.
+type requestLog struct {
+	headers []byte
+}
 
-	if _, err = conn.Write(chRequest); err != nil {
-		return
+func (l *requestLog) expect(want []byte) {
+	for _, header := range want {
+		if !l.late(header) {
+			l.headers = append(l.headers, header)
+		}
+	}
+}
+
+func (l *requestLog) late(header byte) bool { return bytes.IndexByte(l.headers, header) >= 0 }
+
+func (p HandshakePath) String() string {
+	switch p {
+	case HandshakeDirect:
+		return "direct"
+	case HandshakeChallenged:
+		return "challenged"
+	case HandshakeRechallenged:
+		return "rechallenged"
+	case HandshakeCached:
+		return "cached"
 	}
+	return "none"
+}
 
-	st := newPacketStream()
-	if err = st.Gobble(conn); err != nil {
-		return
+func handshakePathFor(challenges int) HandshakePath {
+	switch challenges {
+	case 0:
+		return HandshakeDirect
+	case 1:
+		return HandshakeChallenged
 	}
+	return HandshakeRechallenged
+}
 
-	payload, err := st.GetFullPayload()
-	buf = bytes.NewBuffer(payload)
+// handshake performs a challenged request over conn and returns
+// the payload along with the path it took. build turns a
+// challenge into the request to send, starting with -1. The server
+// may answer with the final payload (whose header byte is one of want)
+// or with a challenge, in which case the request is resent carrying it.
+//
+// If reuse is set and conn remembers a challenge, that challenge is
+// sent first; a server that no longer accepts it hands out a fresh
+// one and the handshake carries on from there.
+func (s *iserver) handshake(ctx context.Context, conn net.Conn, build func(int32) []byte, want []byte, reuse bool) (payload []byte, path HandshakePath, err error) {
+	chalValue := int32(-1)
+	cached := false
+
+	cache, caching := conn.(challengeCache)
+	if caching && reuse {
+		chalValue, cached = cache.cachedChallenge()
+	}
+	earlier, reused := conn.(lateReplies)
+	if reused {
+		defer earlier.expect(want)
+	}
 
-	chal := challenge{}
-	if err = binary.Read(buf, byteOrder, &chal); err != nil {
+	if _, err = conn.Write(build(chalValue)); err != nil {
+		err = stageErr(StageWrite, nil, contextErr(ctx, err))
 		return
 	}
 
-	if chal.Type != 0x41 {
-		err = PacketMalformed
-		return
+	for challenges := 0; challenges <= maxChallengeRounds; {
+		if payload, err = s.receive(ctx, conn); err != nil {
+			return
+		}
+
+		if len(payload) == 0 {
+			err = stageErr(StageDecode, payload, PacketMalformed)
+			return
+		}
+
+		switch header := payload[0]; {
+		case bytes.IndexByte(want, header) >= 0:
+			if caching && chalValue != -1 {
+				cache.storeChallenge(chalValue)
+			}
+			if cached && challenges == 0 {
+				path = HandshakeCached
+			} else {
+				path = handshakePathFor(challenges)
+			}
+			return
+		case header == tChallengeRespID:
+			chal := challenge{}
+			if err = binary.Read(bytes.NewBuffer(payload), byteOrder, &chal); err != nil {
+				err = stageErr(StageChallenge, payload, ChallengeSizeMismatch)
+				return
+			}
+			challenges++
+			chalValue = chal.Challenge
+			if _, err = conn.Write(build(chalValue)); err != nil {
+				err = stageErr(StageWrite, nil, contextErr(ctx, err))
+				return
+			}
+		case reused && earlier.late(header):
+			// A late answer to an earlier query on a reused
+			// socket; keep waiting for ours.
+		default:
+			err = stageErr(StageDecode, payload, PacketMalformed)
+			return
+		}
 	}
 
-	ch = chal.Challenge
-	return
+	return nil, HandshakeNone, stageErr(StageChallenge, payload, ChallengeFailed)
 }
 
 type wrappedChallenge struct {
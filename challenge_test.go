@@ -0,0 +1,114 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testPlayersResponse() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(packetHeader[0:])
+	buf.WriteByte(tPlayersPacketRespID)
+	buf.WriteByte(2)
+	for i, name := range []string{"alice", "bob"} {
+		buf.WriteByte(byte(i))
+		buf.WriteString(name + "\x00")
+		binary.Write(buf, byteOrder, int32(10*(i+1)))
+		binary.Write(buf, byteOrder, float32(60*(i+1)))
+	}
+	return buf.Bytes()
+}
+
+func testRulesResponse() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(packetHeader[0:])
+	buf.WriteByte(tRulesPacketRespID)
+	binary.Write(buf, byteOrder, int16(2))
+	buf.WriteString("mp_friendlyfire\x001\x00")
+	buf.WriteString("sv_cheats\x000\x00")
+	return buf.Bytes()
+}
+
+// testChallengingResponder hands out challenges rounds times
+// before answering with payload. Requests must echo the last
+// challenge handed out.
+func testChallengingResponder(t *testing.T, rounds int, payload []byte) *testResponder {
+	issued := int32(-1)
+	return newTestResponder(t, func(req []byte) [][]byte {
+		var got int32
+		if len(req) < 4 || binary.Read(bytes.NewBuffer(req[len(req)-4:]), byteOrder, &got) != nil {
+			return nil
+		}
+		if got != issued {
+			return nil
+		}
+		if rounds > 0 {
+			rounds--
+			issued = int32(1000 + rounds)
+			return [][]byte{testChallengeResponse(issued)}
+		}
+		return [][]byte{payload}
+	})
+}
+
+// testReportContext gives a query a second and fills in report.
+func testReportContext(t *testing.T, report *QueryReport) context.Context {
+	ctx, cancel := context.WithTimeout(WithQueryReport(context.Background(), report), time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestHandshake_players(t *testing.T) {
+	for rounds, want := range []HandshakePath{HandshakeDirect, HandshakeChallenged, HandshakeRechallenged} {
+		s := testChallengingResponder(t, rounds, testPlayersResponse()).Server()
+
+		report := &QueryReport{}
+		players, err := s.PlayersContext(testReportContext(t, report))
+		if err != nil {
+			t.Log("Unexpected error after", rounds, "challenges:", err)
+			t.FailNow()
+		}
+		if len(players) != 2 || players[1].Name() != "bob" || players[1].Score() != 20 {
+			t.Log("Players decoded incorrectly:", players)
+			t.FailNow()
+		}
+		if report.Handshake != want {
+			t.Log("Expected handshake", want, "got", report.Handshake)
+			t.FailNow()
+		}
+	}
+}
+
+func TestHandshake_rules(t *testing.T) {
+	for rounds, want := range []HandshakePath{HandshakeDirect, HandshakeChallenged, HandshakeRechallenged} {
+		s := testChallengingResponder(t, rounds, testRulesResponse()).Server()
+
+		report := &QueryReport{}
+		rules, err := s.RulesContext(testReportContext(t, report))
+		if err != nil {
+			t.Log("Unexpected error after", rounds, "challenges:", err)
+			t.FailNow()
+		}
+		if len(rules) != 2 || rules["mp_friendlyfire"] != "1" {
+			t.Log("Rules decoded incorrectly:", rules)
+			t.FailNow()
+		}
+		if report.Handshake != want {
+			t.Log("Expected handshake", want, "got", report.Handshake)
+			t.FailNow()
+		}
+	}
+}
+
+func TestHandshake_bounded(t *testing.T) {
+	s := testChallengingResponder(t, maxChallengeRounds+1, testPlayersResponse()).Server()
+
+	if _, err := s.Players(time.Second); !errors.Is(err, ChallengeFailed) {
+		t.Log("Expected ChallengeFailed, got:", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,148 @@
+// Command goseq-rcon runs an RCON command on many servers at once
+// and reports how it went on each.
+//
+//	goseq-rcon -c "say Restarting in 5 minutes" 10.0.0.1:27015 10.0.0.2:27015
+//	goseq-rcon -f servers.txt -json -c status
+//
+// Servers come from the arguments and from -f, a file with one
+// "address [password]" per line. The password is whatever follows
+// the address and the spaces or tabs after it, so it may hold spaces
+// of its own; blank lines and lines starting with # are skipped.
+// Servers without a password of their own use -password, or
+// $GOSEQ_RCON_PASSWORD. The exit status is 1 if the command failed
+// anywhere.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Ronny95/goseq"
+)
+
+var (
+	command  = flag.String("c", "", "the command to run")
+	file     = flag.String("f", "", "read servers from `file`")
+	password = flag.String("password", os.Getenv("GOSEQ_RCON_PASSWORD"), "RCON password of servers without their own")
+	goldsrc  = flag.Bool("goldsrc", false, "use the GoldSrc UDP RCON protocol")
+	workers  = flag.Int("workers", goseq.DefaultFleetOptions.Workers, "servers to work on at once")
+	timeout  = flag.Duration("timeout", goseq.DefaultFleetOptions.Timeout, "time allowed per server")
+	asJSON   = flag.Bool("json", false, "print the report as JSON")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: goseq-rcon [flags] -c command [address ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	targets, err := readTargets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "goseq-rcon:", err)
+		os.Exit(2)
+	}
+	if *command == "" || len(targets) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report := goseq.ExecFleet(ctx, targets, *command, goseq.FleetOptions{Workers: *workers, Timeout: *timeout})
+	if *asJSON {
+		printJSON(report)
+	} else {
+		printText(report)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func readTargets() ([]goseq.FleetTarget, error) {
+	engine := goseq.SourceEngine
+	if *goldsrc {
+		engine = goseq.GoldSrcEngine
+	}
+
+	var targets []goseq.FleetTarget
+	for _, addr := range flag.Args() {
+		targets = append(targets, goseq.FleetTarget{Address: addr, Password: *password, Engine: engine})
+	}
+	if *file == "" {
+		return targets, nil
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target := goseq.FleetTarget{Address: line, Password: *password, Engine: engine}
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			target.Address = line[0:i]
+			target.Password = strings.TrimSpace(line[i:])
+		}
+		targets = append(targets, target)
+	}
+	return targets, scanner.Err()
+}
+
+func printText(report *goseq.FleetReport) {
+	for _, result := range report.Results {
+		if result.Err != nil {
+			fmt.Printf("%s\tFAILED\t%v\t%v\n", result.Address, result.Latency.Round(time.Millisecond), result.Err)
+			continue
+		}
+		fmt.Printf("%s\tok\t%v\n", result.Address, result.Latency.Round(time.Millisecond))
+		for _, line := range strings.Split(strings.TrimRight(result.Output, "\n"), "\n") {
+			fmt.Printf("\t%s\n", line)
+		}
+	}
+	fmt.Printf("%d succeeded, %d failed\n", report.Succeeded, report.Failed)
+}
+
+func printJSON(report *goseq.FleetReport) {
+	type result struct {
+		Address   string  `json:"address"`
+		Output    string  `json:"output,omitempty"`
+		LatencyMS float64 `json:"latency_ms"`
+		Error     string  `json:"error,omitempty"`
+	}
+
+	out := struct {
+		Command   string   `json:"command"`
+		Succeeded int      `json:"succeeded"`
+		Failed    int      `json:"failed"`
+		Results   []result `json:"results"`
+	}{Command: report.Command, Succeeded: report.Succeeded, Failed: report.Failed}
+
+	for _, r := range report.Results {
+		res := result{Address: r.Address, Output: r.Output, LatencyMS: float64(r.Latency) / float64(time.Millisecond)}
+		if r.Err != nil {
+			res.Error = r.Err.Error()
+		}
+		out.Results = append(out.Results, res)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
@@ -0,0 +1,193 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	CrawlStalled error = errors.New("Master did not advance past the last page.")
+)
+
+// CrawlOptions bound a master crawl.
+type CrawlOptions struct {
+	// PageTimeout is how long a master has to answer each
+	// page request; MasterServerTimeout by default.
+	PageTimeout time.Duration
+	// Timeout bounds the whole crawl, on top of any
+	// deadline of the context. Zero means no bound.
+	Timeout time.Duration
+	// MaxPages stops the crawl early. Zero means no limit.
+	MaxPages int
+	// Pacing spaces out page requests and backs off
+	// when the masters start ignoring us.
+	Pacing Pacing
+}
+
+func (o CrawlOptions) pageTimeout() time.Duration {
+	if o.PageTimeout <= 0 {
+		return MasterServerTimeout
+	}
+	return o.PageTimeout
+}
+
+// CrawlResult is what a master crawl found.
+type CrawlResult struct {
+	// Servers lists every address once, in the order
+	// the master handed them out.
+	Servers []Server
+	// Pages is how many pages were fetched.
+	Pages int
+	// Complete is set when the master signalled the end
+	// of the listing; it is unset when the crawl stopped
+	// at MaxPages or failed part way.
+	Complete bool
+	// Pacing is how the crawl was slowed down.
+	Pacing PacingReport
+}
+
+// CrawlItem is one server found by a streaming crawl,
+// or the error that ended it.
+type CrawlItem struct {
+	Server Server
+	// Page is the page the server was listed on, counting from 1.
+	Page int
+	Err  error
+}
+
+func (m *master) Crawl(ctx context.Context, opts CrawlOptions) (*CrawlResult, error) {
+	q := m.snapshot()
+	defer q.closeConnection()
+	return q.crawl(ctx, opts)
+}
+
+func (m *master) CrawlStream(ctx context.Context, opts CrawlOptions) <-chan CrawlItem {
+	items := make(chan CrawlItem)
+	// the consumer may well use m while it reads the stream
+	q := m.snapshot()
+
+	go func() {
+		defer close(items)
+		defer q.closeConnection()
+
+		send := func(item CrawlItem) bool {
+			select {
+			case items <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		err := q.walk(ctx, opts, &CrawlResult{}, func(s Server, page int) bool {
+			return send(CrawlItem{Server: s, Page: page})
+		})
+		if err != nil {
+			send(CrawlItem{Err: err})
+		}
+	}()
+
+	return items
+}
+
+// crawl is Crawl on a snapshot.
+func (m *master) crawl(ctx context.Context, opts CrawlOptions) (*CrawlResult, error) {
+	result := &CrawlResult{}
+	err := m.walk(ctx, opts, result, func(s Server, _ int) bool {
+		result.Servers = append(result.Servers, s)
+		return true
+	})
+	return result, err
+}
+
+// walk pages through the listing, handing every new address to yield
+// as soon as its page is decoded. The next page is only requested once
+// yield has taken the current one; yield returning false stops the walk.
+// Everything but the servers themselves is recorded in result.
+func (m *master) walk(ctx context.Context, opts CrawlOptions, result *CrawlResult, yield func(s Server, page int) bool) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	pace := newPacer(opts.Pacing)
+	defer func() { result.Pacing = pace.report }()
+
+	seen := make(map[wireIP]bool)
+	seed := Beggining
+
+	for opts.MaxPages <= 0 || result.Pages < opts.MaxPages {
+		ips, err := m.pacedPage(ctx, seed, opts.pageTimeout(), pace)
+		if err != nil {
+			return queryErr(m.addr, MasterRequest, err)
+		}
+		result.Pages++
+
+		for _, ip := range ips {
+			if ip == (wireIP{}) || seen[ip] {
+				continue
+			}
+			seen[ip] = true
+			server := NewServer()
+			server.SetAddress(ip.String())
+			if !yield(server, result.Pages) {
+				return nil
+			}
+		}
+
+		if len(ips) == 0 {
+			return queryErr(m.addr, MasterRequest, stageErr(StageDecode, nil, CrawlStalled))
+		}
+
+		// the last address seeds the next page,
+		// until the master wraps around to Beggining
+		last := ips[len(ips)-1]
+		if last == (wireIP{}) {
+			result.Complete = true
+			return nil
+		}
+		if last.String() == seed {
+			return queryErr(m.addr, MasterRequest, stageErr(StageDecode, nil, CrawlStalled))
+		}
+		seed = last.String()
+	}
+
+	return nil
+}
+
+// pacedPage is page under a pacer: a master that served us before
+// and then goes silent is rate limiting, so it is retried after a
+// backoff instead of being given up on straight away.
+func (m *master) pacedPage(ctx context.Context, at string, timeout time.Duration, pace *pacer) ([]wireIP, error) {
+	tried := map[string]bool{}
+	retries := 0
+
+	for {
+		if err := pace.wait(ctx); err != nil {
+			return nil, stageErr(StageWrite, nil, err)
+		}
+
+		ips, e := m.fetch(ctx, at, timeout)
+		switch {
+		case e == nil:
+			pace.answered = true
+			return ips, nil
+		case !errors.Is(e, Timeout) || ctx.Err() != nil:
+			return nil, e
+		case pace.answered && retries < pace.MaxRetries:
+			if err := pace.backoff(ctx, retries); err != nil {
+				return nil, stageErr(StageRead, nil, err)
+			}
+			retries++
+		default:
+			pace.answered = false
+			retries = 0
+			if !m.rotate(tried) {
+				// we've come full circle, time to quit.
+				return nil, e
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package goseq
+
+import (
+	"fmt"
+)
+
+// RequestType is the kind of query that failed.
+// Values are the request identifiers used on the wire.
+type RequestType byte
+
+const (
+	PingRequest    RequestType = RequestType(0x69) // "i"
+	InfoRequest    RequestType = RequestType(tInfoPacketReqID)
+	PlayersRequest RequestType = RequestType(tPlayersPacketReqID)
+	RulesRequest   RequestType = RequestType(tRulesPacketReqID)
+	MasterRequest  RequestType = RequestType(0x31) // "1"
+	RCONRequest    RequestType = RequestType(0x72) // "r"
+)
+
+func (r RequestType) String() string {
+	switch r {
+	case PingRequest:
+		return "ping"
+	case InfoRequest:
+		return "info"
+	case PlayersRequest:
+		return "players"
+	case RulesRequest:
+		return "rules"
+	case MasterRequest:
+		return "master"
+	case RCONRequest:
+		return "rcon"
+	}
+	return fmt.Sprintf("request 0x%02X", byte(r))
+}
+
+// Stage is the step of a query that failed.
+type Stage byte
+
+const (
+	// StageConnect is resolving the address and opening the socket.
+	StageConnect Stage = iota
+	// StageWrite is sending a request.
+	StageWrite
+	// StageRead is waiting for the datagrams of a response.
+	StageRead
+	// StageChallenge is negotiating a challenge with the server.
+	StageChallenge
+	// StageDecode is reassembling and decoding a complete response.
+	StageDecode
+	// StageAuth is logging in to RCON.
+	StageAuth
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageConnect:
+		return "connect"
+	case StageWrite:
+		return "write"
+	case StageRead:
+		return "read"
+	case StageChallenge:
+		return "challenge"
+	case StageDecode:
+		return "decode"
+	case StageAuth:
+		return "auth"
+	}
+	return "unknown stage"
+}
+
+// QueryError is the error returned by every Server and MasterServer
+// query. It wraps one of the package's errors (Timeout, PacketMalformed,
+// ChallengeFailed, ...) or a network or context error, so test for
+// those with errors.Is.
+type QueryError struct {
+	// Addr is the address of the server queried.
+	Addr    string
+	Request RequestType
+	Stage   Stage
+	// Payload is a copy of the response that could not be
+	// handled, when there was one.
+	Payload []byte
+	// Attempts is how many times the query was sent,
+	// see RetryPolicy. It is 0 for MasterServer queries.
+	Attempts int
+	Err      error
+}
+
+func (e *QueryError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("%s query to %s failed at %s after %d attempts: %v", e.Request, e.Addr, e.Stage, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("%s query to %s failed at %s: %v", e.Request, e.Addr, e.Stage, e.Err)
+}
+
+func (e *QueryError) Unwrap() error { return e.Err }
+
+// stageErr wraps err in a QueryError failed at stage, keeping a copy
+// of payload. Errors that already are a QueryError pass unchanged.
+func stageErr(stage Stage, payload []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*QueryError); ok {
+		return err
+	}
+	qerr := &QueryError{Stage: stage, Err: err}
+	if payload != nil {
+		qerr.Payload = append([]byte(nil), payload...)
+	}
+	return qerr
+}
+
+// queryErr completes err with the address and request it came from.
+// Errors not yet wrapped by stageErr failed while connecting.
+func queryErr(addr string, req RequestType, err error) error {
+	if err == nil {
+		return nil
+	}
+	qerr, ok := err.(*QueryError)
+	if !ok {
+		qerr = stageErr(StageConnect, nil, err).(*QueryError)
+	}
+	qerr.Addr = addr
+	qerr.Request = req
+	return qerr
+}
@@ -0,0 +1,672 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ExprInvalid     error = errors.New("Expression is invalid.")
+	ExprMissingData error = errors.New("Expression needs data the server state doesn't have.")
+)
+
+// ExprError is returned by CompileExpr for expressions that don't
+// parse or don't type check. It matches ExprInvalid with errors.Is.
+type ExprError struct {
+	// Pos is the byte offset in the expression where the problem starts.
+	Pos int
+	Msg string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("Expression is invalid at position %d: %s.", e.Pos, e.Msg)
+}
+
+func (e *ExprError) Is(target error) bool { return target == ExprInvalid }
+
+// ServerState is what an Expr is evaluated against: whatever was
+// learnt about one server. Only the parts the expression uses need
+// to be filled in; nil stands for a part that wasn't queried, so an
+// empty server has empty, not nil, Players.
+type ServerState struct {
+	Address string
+	Info    *ServerInfo
+	Players []Player
+	Rules   RuleMap
+}
+
+// Expr is a compiled filter over ServerStates, for refining results
+// the master's filters let through. Expressions combine comparisons
+// with &&, || and ! and parentheses:
+//
+//	players >= 10 && map ~ "de_*" && !vac && rules["mp_friendlyfire"] == "1"
+//
+// Values are ints, strings and bools. == and != compare values of the
+// same type, < <= > >= compare ints, and ~ and !~ match a string
+// against a pattern where * stands for any run of characters and ?
+// for any one, ignoring case.
+//
+// Info fields: name, map, folder, game, version, keywords, engine
+// (strings); appid, players, max_players, bots, humans, port (ints);
+// dedicated, listen, sourcetv, linux, windows, mac, password, vac
+// (bools).
+//
+// address (string) is the ServerState's Address.
+//
+// Players: player_count (int), has_player("pattern") (bool).
+//
+// Rules: rules["name"] (string, "" if unset), has_rule("name") (bool).
+//
+// An Expr is safe for concurrent use.
+type Expr struct {
+	src  string
+	eval func(*ServerState) bool
+
+	needsInfo, needsPlayers, needsRules bool
+}
+
+// CompileExpr parses and type checks src. The expression must be
+// a bool.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{lex: exprLexer{src: src}, expr: &Expr{src: src}}
+	p.advance()
+
+	n, err := p.or()
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.fail(p.tok.pos, "unexpected %s", p.tok)
+	}
+	if n.typ != exprBool {
+		return nil, p.fail(0, "expression is %s, not bool", n.typ)
+	}
+
+	p.expr.eval = n.b
+	return p.expr, nil
+}
+
+// String returns the source the Expr was compiled from.
+func (e *Expr) String() string { return e.src }
+
+// NeedsInfo reports whether the Expr uses info fields.
+func (e *Expr) NeedsInfo() bool { return e.needsInfo }
+
+// NeedsPlayers reports whether the Expr uses the player list.
+func (e *Expr) NeedsPlayers() bool { return e.needsPlayers }
+
+// NeedsRules reports whether the Expr uses rules.
+func (e *Expr) NeedsRules() bool { return e.needsRules }
+
+// Match evaluates the Expr against s. It fails with ExprMissingData
+// if s lacks the info, players or rules the Expr uses.
+func (e *Expr) Match(s *ServerState) (bool, error) {
+	switch {
+	case e.needsInfo && s.Info == nil:
+		return false, fmt.Errorf("%w (info of %s)", ExprMissingData, s.Address)
+	case e.needsPlayers && s.Players == nil:
+		return false, fmt.Errorf("%w (players of %s)", ExprMissingData, s.Address)
+	case e.needsRules && s.Rules == nil:
+		return false, fmt.Errorf("%w (rules of %s)", ExprMissingData, s.Address)
+	}
+	return e.eval(s), nil
+}
+
+// Filter passes on the states from in that match, until in is closed
+// or ctx is done. States that can't be matched are dropped.
+func (e *Expr) Filter(ctx context.Context, in <-chan *ServerState) <-chan *ServerState {
+	out := make(chan *ServerState)
+	go func() {
+		defer close(out)
+		for {
+			var s *ServerState
+			var ok bool
+			select {
+			case s, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+
+			if match, err := e.Match(s); err != nil || !match {
+				continue
+			}
+
+			select {
+			case out <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+type exprType int
+
+const (
+	exprBool exprType = iota
+	exprInt
+	exprString
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprBool:
+		return "bool"
+	case exprInt:
+		return "int"
+	}
+	return "string"
+}
+
+// exprNode is a typed, compiled piece of an expression.
+// Only the func matching typ is set.
+type exprNode struct {
+	typ exprType
+	pos int
+	b   func(*ServerState) bool
+	i   func(*ServerState) int
+	s   func(*ServerState) string
+}
+
+func boolNode(f func(*ServerInfo) bool) exprNode {
+	return exprNode{typ: exprBool, b: func(s *ServerState) bool { return f(s.Info) }}
+}
+
+func intNode(f func(*ServerInfo) int) exprNode {
+	return exprNode{typ: exprInt, i: func(s *ServerState) int { return f(s.Info) }}
+}
+
+func stringNode(f func(*ServerInfo) string) exprNode {
+	return exprNode{typ: exprString, s: func(s *ServerState) string { return f(s.Info) }}
+}
+
+// exprInfoFields are the identifiers that read from ServerState.Info.
+var exprInfoFields = map[string]exprNode{
+	"name":        stringNode((*ServerInfo).GetName),
+	"map":         stringNode((*ServerInfo).GetMap),
+	"folder":      stringNode((*ServerInfo).GetFolder),
+	"game":        stringNode((*ServerInfo).GetGame),
+	"version":     stringNode((*ServerInfo).GetVersion),
+	"keywords":    stringNode((*ServerInfo).GetKeywords),
+	"engine":      stringNode(func(i *ServerInfo) string { return i.GetEngine().String() }),
+	"appid":       intNode(func(i *ServerInfo) int { return int(i.GetID()) }),
+	"players":     intNode(func(i *ServerInfo) int { return int(i.GetPlayers()) }),
+	"max_players": intNode(func(i *ServerInfo) int { return int(i.GetMaxPlayers()) }),
+	"bots":        intNode(func(i *ServerInfo) int { return int(i.GetBots()) }),
+	"humans":      intNode(func(i *ServerInfo) int { return int(i.GetPlayers()) - int(i.GetBots()) }),
+	"port":        intNode(func(i *ServerInfo) int { return int(i.GetPort()) }),
+	"dedicated":   boolNode(func(i *ServerInfo) bool { return i.GetServertype() == Dedicated }),
+	"listen":      boolNode(func(i *ServerInfo) bool { return i.GetServertype() == Listen }),
+	"sourcetv":    boolNode(func(i *ServerInfo) bool { return i.GetServertype() == SourceTV }),
+	"linux":       boolNode(func(i *ServerInfo) bool { return i.GetEnvironment() == Linux }),
+	"windows":     boolNode(func(i *ServerInfo) bool { return i.GetEnvironment() == Windows }),
+	"mac":         boolNode(func(i *ServerInfo) bool { return i.GetEnvironment() == Mac }),
+	"password":    boolNode(func(i *ServerInfo) bool { return i.GetVisibility() == 1 }),
+	"vac":         boolNode(func(i *ServerInfo) bool { return i.GetVAC() == 1 }),
+}
+
+type exprParser struct {
+	lex  exprLexer
+	tok  exprToken
+	expr *Expr
+	err  error
+}
+
+func (p *exprParser) fail(pos int, format string, args ...interface{}) error {
+	return &ExprError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) advance() {
+	if p.err == nil {
+		p.tok, p.err = p.lex.next()
+	}
+}
+
+// expect consumes a token of kind, or fails.
+func (p *exprParser) expect(kind tokenKind) (exprToken, error) {
+	if p.err != nil {
+		return p.tok, p.err
+	}
+	tok := p.tok
+	if tok.kind != kind {
+		return tok, p.fail(tok.pos, "expected %s, got %s", kind, tok)
+	}
+	p.advance()
+	return tok, p.err
+}
+
+// or := and { "||" and }
+func (p *exprParser) or() (exprNode, error) {
+	left, err := p.and()
+	for err == nil && p.tok.kind == tokOr {
+		op := p.tok
+		p.advance()
+		var right exprNode
+		if right, err = p.and(); err != nil {
+			break
+		}
+		if err = p.bothBool(op, left, right); err != nil {
+			break
+		}
+		l, r := left.b, right.b
+		left = exprNode{typ: exprBool, pos: left.pos, b: func(s *ServerState) bool { return l(s) || r(s) }}
+	}
+	return left, err
+}
+
+// and := not { "&&" not }
+func (p *exprParser) and() (exprNode, error) {
+	left, err := p.not()
+	for err == nil && p.tok.kind == tokAnd {
+		op := p.tok
+		p.advance()
+		var right exprNode
+		if right, err = p.not(); err != nil {
+			break
+		}
+		if err = p.bothBool(op, left, right); err != nil {
+			break
+		}
+		l, r := left.b, right.b
+		left = exprNode{typ: exprBool, pos: left.pos, b: func(s *ServerState) bool { return l(s) && r(s) }}
+	}
+	return left, err
+}
+
+func (p *exprParser) bothBool(op exprToken, left, right exprNode) error {
+	if left.typ != exprBool {
+		return p.fail(left.pos, "%s needs bools, left side is %s", op, left.typ)
+	}
+	if right.typ != exprBool {
+		return p.fail(right.pos, "%s needs bools, right side is %s", op, right.typ)
+	}
+	return nil
+}
+
+// not := "!" not | comparison
+func (p *exprParser) not() (exprNode, error) {
+	if p.tok.kind != tokNot {
+		return p.comparison()
+	}
+	op := p.tok
+	p.advance()
+	n, err := p.not()
+	if err != nil {
+		return n, err
+	}
+	if n.typ != exprBool {
+		return n, p.fail(n.pos, "! needs a bool, got %s", n.typ)
+	}
+	b := n.b
+	return exprNode{typ: exprBool, pos: op.pos, b: func(s *ServerState) bool { return !b(s) }}, nil
+}
+
+// comparison := operand [ op operand ]
+func (p *exprParser) comparison() (exprNode, error) {
+	left, err := p.operand()
+	if err != nil {
+		return left, err
+	}
+
+	op := p.tok
+	switch op.kind {
+	case tokEq, tokNe, tokLt, tokLe, tokGt, tokGe, tokMatch, tokNoMatch:
+	default:
+		return left, nil
+	}
+	p.advance()
+
+	right, err := p.operand()
+	if err != nil {
+		return right, err
+	}
+	if left.typ != right.typ {
+		return right, p.fail(right.pos, "can't compare %s with %s", left.typ, right.typ)
+	}
+
+	n := exprNode{typ: exprBool, pos: left.pos}
+	switch op.kind {
+	case tokMatch, tokNoMatch:
+		if left.typ != exprString {
+			return left, p.fail(left.pos, "%s needs strings, got %s", op, left.typ)
+		}
+		l, r, negate := left.s, right.s, op.kind == tokNoMatch
+		n.b = func(s *ServerState) bool { return globMatch(r(s), l(s)) != negate }
+	case tokLt, tokLe, tokGt, tokGe:
+		if left.typ != exprInt {
+			return left, p.fail(left.pos, "%s needs ints, got %s", op, left.typ)
+		}
+		l, r, kind := left.i, right.i, op.kind
+		n.b = func(s *ServerState) bool {
+			a, b := l(s), r(s)
+			switch kind {
+			case tokLt:
+				return a < b
+			case tokLe:
+				return a <= b
+			case tokGt:
+				return a > b
+			}
+			return a >= b
+		}
+	default:
+		eq := p.equal(left, right)
+		if op.kind == tokNe {
+			n.b = func(s *ServerState) bool { return !eq(s) }
+		} else {
+			n.b = eq
+		}
+	}
+	return n, nil
+}
+
+// equal compares two nodes of the same type.
+func (p *exprParser) equal(left, right exprNode) func(*ServerState) bool {
+	switch left.typ {
+	case exprInt:
+		l, r := left.i, right.i
+		return func(s *ServerState) bool { return l(s) == r(s) }
+	case exprString:
+		l, r := left.s, right.s
+		return func(s *ServerState) bool { return l(s) == r(s) }
+	}
+	l, r := left.b, right.b
+	return func(s *ServerState) bool { return l(s) == r(s) }
+}
+
+// operand := literal | identifier | call | rules "[" string "]" | "(" or ")"
+func (p *exprParser) operand() (exprNode, error) {
+	if p.err != nil {
+		return exprNode{}, p.err
+	}
+
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		p.advance()
+		v := tok.ival
+		return exprNode{typ: exprInt, pos: tok.pos, i: func(*ServerState) int { return v }}, p.err
+	case tokString:
+		p.advance()
+		v := tok.text
+		return exprNode{typ: exprString, pos: tok.pos, s: func(*ServerState) string { return v }}, p.err
+	case tokLParen:
+		p.advance()
+		n, err := p.or()
+		if err != nil {
+			return n, err
+		}
+		_, err = p.expect(tokRParen)
+		return n, err
+	case tokIdent:
+		p.advance()
+		if p.err != nil {
+			return exprNode{}, p.err
+		}
+		return p.identifier(tok)
+	}
+	return exprNode{}, p.fail(tok.pos, "unexpected %s", tok)
+}
+
+func (p *exprParser) identifier(tok exprToken) (exprNode, error) {
+	switch tok.text {
+	case "true", "false":
+		v := tok.text == "true"
+		return exprNode{typ: exprBool, pos: tok.pos, b: func(*ServerState) bool { return v }}, nil
+
+	case "player_count":
+		p.expr.needsPlayers = true
+		return exprNode{typ: exprInt, pos: tok.pos, i: func(s *ServerState) int { return len(s.Players) }}, nil
+
+	case "rules":
+		if _, err := p.expect(tokLBracket); err != nil {
+			return exprNode{}, err
+		}
+		name, err := p.expect(tokString)
+		if err != nil {
+			return exprNode{}, err
+		}
+		if _, err := p.expect(tokRBracket); err != nil {
+			return exprNode{}, err
+		}
+		p.expr.needsRules = true
+		return exprNode{typ: exprString, pos: tok.pos, s: func(s *ServerState) string { return s.Rules[name.text] }}, nil
+
+	case "has_rule", "has_player":
+		arg, err := p.call(tok)
+		if err != nil {
+			return exprNode{}, err
+		}
+		if tok.text == "has_rule" {
+			p.expr.needsRules = true
+			return exprNode{typ: exprBool, pos: tok.pos, b: func(s *ServerState) bool {
+				_, ok := s.Rules[arg.text]
+				return ok
+			}}, nil
+		}
+		p.expr.needsPlayers = true
+		return exprNode{typ: exprBool, pos: tok.pos, b: func(s *ServerState) bool {
+			for _, player := range s.Players {
+				if globMatch(arg.text, player.Name()) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+
+	case "address":
+		return exprNode{typ: exprString, pos: tok.pos, s: func(s *ServerState) string { return s.Address }}, nil
+	}
+
+	n, ok := exprInfoFields[tok.text]
+	if !ok {
+		return n, p.fail(tok.pos, "unknown identifier %q", tok.text)
+	}
+	p.expr.needsInfo = true
+	n.pos = tok.pos
+	return n, nil
+}
+
+// call parses the single string argument of fn.
+func (p *exprParser) call(fn exprToken) (exprToken, error) {
+	if _, err := p.expect(tokLParen); err != nil {
+		return exprToken{}, err
+	}
+	arg, err := p.expect(tokString)
+	if err != nil && p.err == nil {
+		return arg, p.fail(arg.pos, "%s takes a string", fn.text)
+	}
+	if err != nil {
+		return arg, err
+	}
+	_, err = p.expect(tokRParen)
+	return arg, err
+}
+
+// globMatch reports whether s matches pattern, where * matches any
+// run of characters and ? any one character, ignoring case.
+func globMatch(pattern, s string) bool {
+	pr, sr := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(s))
+
+	// the usual backtracking to the last star
+	pi, si := 0, 0
+	star, mark := -1, 0
+	for si < len(sr) {
+		switch {
+		case pi < len(pr) && (pr[pi] == '?' || pr[pi] == sr[si]):
+			pi++
+			si++
+		case pi < len(pr) && pr[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(pr) && pr[pi] == '*' {
+		pi++
+	}
+	return pi == len(pr)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokAnd
+	tokOr
+	tokNot
+	tokEq
+	tokNe
+	tokLt
+	tokLe
+	tokGt
+	tokGe
+	tokMatch
+	tokNoMatch
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:      "end of expression",
+	tokIdent:    "identifier",
+	tokInt:      "number",
+	tokString:   "string",
+	tokLParen:   "(",
+	tokRParen:   ")",
+	tokLBracket: "[",
+	tokRBracket: "]",
+	tokAnd:      "&&",
+	tokOr:       "||",
+	tokNot:      "!",
+	tokEq:       "==",
+	tokNe:       "!=",
+	tokLt:       "<",
+	tokLe:       "<=",
+	tokGt:       ">",
+	tokGe:       ">=",
+	tokMatch:    "~",
+	tokNoMatch:  "!~",
+}
+
+func (k tokenKind) String() string { return tokenNames[k] }
+
+type exprToken struct {
+	kind tokenKind
+	pos  int
+	text string
+	ival int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokIdent, tokInt:
+		return fmt.Sprintf("%s %s", t.kind, t.text)
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	case tokEOF:
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%q", t.kind.String())
+}
+
+// exprOperators are tried longest first.
+var exprOperators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"&&", tokAnd}, {"||", tokOr}, {"==", tokEq}, {"!=", tokNe},
+	{"<=", tokLe}, {">=", tokGe}, {"!~", tokNoMatch},
+	{"<", tokLt}, {">", tokGt}, {"!", tokNot}, {"~", tokMatch},
+	{"(", tokLParen}, {")", tokRParen}, {"[", tokLBracket}, {"]", tokRBracket},
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+func (l *exprLexer) next() (exprToken, error) {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+	start := l.pos
+	if start == len(l.src) {
+		return exprToken{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[start]
+	switch {
+	case c == '"':
+		return l.string()
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		v, err := strconv.Atoi(text)
+		if err != nil {
+			return exprToken{}, &ExprError{Pos: start, Msg: fmt.Sprintf("number %s is out of range", text)}
+		}
+		return exprToken{kind: tokInt, pos: start, text: text, ival: v}, nil
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for l.pos < len(l.src) && isIdentByte(l.src[l.pos]) {
+			l.pos++
+		}
+		return exprToken{kind: tokIdent, pos: start, text: l.src[start:l.pos]}, nil
+	}
+
+	for _, op := range exprOperators {
+		if strings.HasPrefix(l.src[start:], op.text) {
+			l.pos += len(op.text)
+			return exprToken{kind: op.kind, pos: start, text: op.text}, nil
+		}
+	}
+	return exprToken{}, &ExprError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+}
+
+// string lexes a double quoted string, in which \" and \\ escape.
+func (l *exprLexer) string() (exprToken, error) {
+	start := l.pos
+	l.pos++
+
+	var text strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		switch {
+		case c == '"':
+			return exprToken{kind: tokString, pos: start, text: text.String()}, nil
+		case c == '\\' && l.pos < len(l.src):
+			text.WriteByte(l.src[l.pos])
+			l.pos++
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return exprToken{}, &ExprError{Pos: start, Msg: "unterminated string"}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,171 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testServerState(t *testing.T) *ServerState {
+	info := NewServerInfo()
+	if err := info.decode(bytes.NewBuffer(testInfoResponse()[packetHeaderSz:])); err != nil {
+		t.Log("Unexpected error decoding the test info:", err)
+		t.FailNow()
+	}
+	players, err := decodePlayers(testPlayersResponse()[packetHeaderSz:], DefaultLimits)
+	if err != nil {
+		t.Log("Unexpected error decoding the test players:", err)
+		t.FailNow()
+	}
+	return &ServerState{
+		Address: "10.0.0.1:27015",
+		Info:    &info,
+		Players: players,
+		Rules:   RuleMap{"mp_friendlyfire": "1", "sv_cheats": "0"},
+	}
+}
+
+func TestExpr_Match(t *testing.T) {
+	s := testServerState(t)
+
+	cases := map[string]bool{
+		`players >= 10 && map ~ "DE_*" && vac && rules["mp_friendlyfire"] == "1"`: true,
+		`players >= 10 && !vac`:                                          false,
+		`humans == 10 && (linux || windows) && dedicated`:                true,
+		`name !~ "*test*" || max_players < 16`:                           false,
+		`has_rule("sv_cheats") && !has_rule("sv_password")`:              true,
+		`rules["sv_password"] == ""`:                                     true,
+		`player_count > 0 && has_player("ALI*") && !has_player("carol")`: true,
+		`address == "10.0.0.1:27015" && port == 27015 && !password`:      true,
+		`(keywords ~ "secure,valve_?s") == true`:                         true,
+	}
+
+	for src, expected := range cases {
+		e, err := CompileExpr(src)
+		if err != nil {
+			t.Log("Unexpected error compiling", src, ":", err)
+			t.FailNow()
+		}
+		got, err := e.Match(s)
+		if err != nil || got != expected {
+			t.Log("Expected", expected, "for", src, "got", got, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestExpr_errors(t *testing.T) {
+	cases := map[string]int{
+		`players >= "10"`:           11,
+		`map && vac`:                0,
+		`!players`:                  1,
+		`players < 10 &&`:           15,
+		`bogus == 1`:                0,
+		`rules[1] == "1"`:           6,
+		`map ~ "de_*`:               6,
+		`players == 1 $`:            13,
+		`(vac`:                      4,
+		`players`:                   0,
+		`has_player(name)`:          11,
+		`map ~ 3 || vac`:            6,
+		`players > 1 players > 2`:   12,
+		`name ~ "x" && players ~ 1`: 14,
+	}
+
+	for src, pos := range cases {
+		_, err := CompileExpr(src)
+		var eerr *ExprError
+		if !errors.As(err, &eerr) || !errors.Is(err, ExprInvalid) {
+			t.Log("Expected an ExprError for", src, "got", err)
+			t.FailNow()
+		}
+		if eerr.Pos != pos {
+			t.Log("Expected position", pos, "for", src, "got", eerr)
+			t.FailNow()
+		}
+	}
+}
+
+func TestExpr_emptyServer(t *testing.T) {
+	empty := []byte{tPlayersPacketRespID, 0}
+	players, err := decodePlayers(empty, DefaultLimits)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	e, err := CompileExpr(`player_count == 0`)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if ok, err := e.Match(&ServerState{Players: players}); !ok || err != nil {
+		t.Log("Expected an empty server to match, got", ok, err)
+		t.FailNow()
+	}
+	if _, err := e.Match(&ServerState{}); !errors.Is(err, ExprMissingData) {
+		t.Log("Expected ExprMissingData without players, got", err)
+		t.FailNow()
+	}
+}
+
+func TestExpr_Filter(t *testing.T) {
+	e, err := CompileExpr(`players >= 10 && rules["mp_friendlyfire"] == "1"`)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if !e.NeedsInfo() || e.NeedsPlayers() || !e.NeedsRules() {
+		t.Log("Expr reports the wrong needs.")
+		t.FailNow()
+	}
+
+	full := testServerState(t)
+	noRules := testServerState(t)
+	noRules.Rules = nil
+	if _, err := e.Match(noRules); !errors.Is(err, ExprMissingData) {
+		t.Log("Expected ExprMissingData, got", err)
+		t.FailNow()
+	}
+	friendly := testServerState(t)
+	friendly.Rules = RuleMap{"mp_friendlyfire": "0"}
+
+	in := make(chan *ServerState, 3)
+	in <- full
+	in <- noRules
+	in <- friendly
+	close(in)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var got []*ServerState
+	for s := range e.Filter(ctx, in) {
+		got = append(got, s)
+	}
+	if len(got) != 1 || got[0] != full {
+		t.Log("Expected only the full state through, got", got)
+		t.FailNow()
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := map[[2]string]bool{
+		{"de_*", "de_dust2"}:    true,
+		{"de_*", "cs_office"}:   false,
+		{"*dust?", "de_dust2"}:  true,
+		{"*a*b*", "xaxxbx"}:     true,
+		{"*a*b", "xaxxbx"}:      false,
+		{"", ""}:                true,
+		{"*", ""}:               true,
+		{"Ärger*", "ärgerlich"}: true,
+	}
+	for c, expected := range cases {
+		if globMatch(c[0], c[1]) != expected {
+			t.Log("Expected", expected, "matching", c[1], "against", c[0])
+			t.FailNow()
+		}
+	}
+}
@@ -8,11 +8,14 @@ import (
 
 var (
 	NOKEY   error = errors.New("The key you requested does not exist!")
-	BADTYPE error = errors.New("Filter doesn't know how to encode the value you specified. Use an int, string, or bool.")
+	BADTYPE error = errors.New("Filter doesn't know how to encode the value you specified. Use an int, string, bool, or a Filter holding the conditions of a nor or nand group.")
 )
 
 // Filter allows a client to refine the
-// results from the MasterServer
+// results from the MasterServer.
+//
+// The nor and nand keys take a Filter holding the conditions
+// of the group, and Get returns them as one.
 type Filter interface {
 	Set(key string, value interface{}) error
 	Get(key string) (interface{}, error)
@@ -25,61 +28,93 @@ type Filter interface {
 // NewFilter creates Filter with the default
 // implementation.
 func NewFilter() Filter {
-	return &msfilter{parameters: make(map[string]interface{})}
+	return newmsfilter()
+}
+
+func newmsfilter() *msfilter {
+	return &msfilter{}
 }
 
 // msfilter implements Filter
 // Default implementation.
+// Parameters keep the order they were first set in,
+// so the filter string is always the same.
 type msfilter struct {
-	parameters map[string]interface{}
+	parameters []filterParam
+}
+
+type filterParam struct {
+	key string
+	// int, bool, string, or a Filter holding
+	// the conditions of a nor/nand group
+	value interface{}
 }
 
 func (fil *msfilter) Set(key string, value interface{}) error {
 	switch v := value.(type) {
-	case int, bool, string:
-		fil.parameters[key] = v
+	case int, bool, string, Filter:
+		if i := fil.index(key); i >= 0 {
+			fil.parameters[i].value = v
+		} else {
+			fil.parameters = append(fil.parameters, filterParam{key, v})
+		}
 		return nil
 	}
 	return BADTYPE
 }
 
+func (fil *msfilter) index(key string) int {
+	for i, param := range fil.parameters {
+		if param.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
 func (fil *msfilter) Get(key string) (interface{}, error) {
 	if !fil.Has(key) {
 		return nil, NOKEY
 	}
-	return fil.parameters[key], nil
+	return fil.parameters[fil.index(key)].value, nil
 }
 
 func (fil *msfilter) Has(key string) bool {
-	_, ok := fil.parameters[key]
-	if !ok {
-		return false
-	}
-	return true
+	return fil.index(key) >= 0
 }
 
 func (fil *msfilter) Delete(key string) {
-	delete(fil.parameters, key)
+	if i := fil.index(key); i >= 0 {
+		fil.parameters = append(fil.parameters[:i], fil.parameters[i+1:]...)
+	}
 }
 
 func (fil *msfilter) Keys() []string {
-	keys := make([]string, len(fil.parameters))
-	for key, _ := range fil.parameters {
-		keys = append(keys, key)
+	keys := make([]string, 0, len(fil.parameters))
+	for _, param := range fil.parameters {
+		keys = append(keys, param.key)
 	}
 	return keys
 }
 
 func (fil *msfilter) GetFilterFormat() []byte {
 	buf := bytes.NewBuffer([]byte{})
+	fil.format(buf)
+	buf.WriteByte(0x0) // NULL terminated
+	return buf.Bytes()
+}
 
-	for key, val := range fil.parameters {
+// format writes the parameters without the NULL terminator.
+// Groups are written as their key and the number of conditions
+// directly inside them, followed by those conditions.
+func (fil *msfilter) format(buf *bytes.Buffer) {
+	for _, param := range fil.parameters {
 		// write key
 		buf.WriteString("\\")
-		buf.WriteString(key)
+		buf.WriteString(param.key)
 		buf.WriteString("\\")
 		// write val
-		switch v := val.(type) {
+		switch v := param.value.(type) {
 		case string:
 			buf.WriteString(v)
 		case int:
@@ -90,11 +125,14 @@ func (fil *msfilter) GetFilterFormat() []byte {
 			} else {
 				buf.WriteString("0")
 			}
+		case *msfilter:
+			buf.WriteString(fmt.Sprintf("%d", len(v.parameters)))
+			v.format(buf)
+		case Filter:
+			buf.WriteString(fmt.Sprintf("%d", len(v.Keys())))
+			buf.Write(bytes.TrimSuffix(v.GetFilterFormat(), []byte{0x0}))
 		default:
 			panic("Filter.Set() should have not allowed this value!")
 		}
 	}
-
-	buf.WriteByte(0x0) // NULL terminated
-	return buf.Bytes()
 }
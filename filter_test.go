@@ -1,6 +1,7 @@
 package goseq
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
@@ -284,3 +285,135 @@ func TestFilter_GetFilterFormat_multi(t *testing.T) {
 	}
 
 }
+
+func TestFilter_GetFilterFormat_ordered(t *testing.T) {
+	fil := NewFilter()
+	fil.Set("secure", true)
+	fil.Set("appid", 730)
+	fil.Set("map", "de_dust2")
+	fil.Set("appid", 240) // keeps its place
+
+	expected := "\\secure\\1\\appid\\240\\map\\de_dust2\x00"
+	for i := 0; i < 10; i++ {
+		if string(fil.GetFilterFormat()) != expected {
+			t.Log("Expected:", expected)
+			t.Log("Got:", string(fil.GetFilterFormat()))
+			t.FailNow()
+		}
+	}
+}
+
+func TestFilterBuilder(t *testing.T) {
+	fil := NewFilterBuilder().
+		AppID(730).
+		Dedicated().
+		GameType("secure", "competitive").
+		Nor(func(g *FilterBuilder) {
+			g.Map("de_dust2").Nand(func(g *FilterBuilder) {
+				g.NoPlayers().Linux()
+			})
+		}).
+		NameMatch("goseq*").
+		Filter()
+
+	expected := "\\appid\\730\\dedicated\\1\\gametype\\secure,competitive" +
+		"\\nor\\2\\map\\de_dust2\\nand\\2\\noplayers\\1\\linux\\1" +
+		"\\name_match\\goseq*\x00"
+
+	if string(fil.GetFilterFormat()) != expected {
+		t.Log("Expected:", expected)
+		t.Log("Got:", string(fil.GetFilterFormat()))
+		t.FailNow()
+	}
+}
+
+func TestParseFilter_roundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"\\appid\\730\\empty\\1\x00",
+		"\\appid\\730\\password\\0\\gametype\\secure,competitive",
+		"\\napp\\500\\nor\\2\\map\\de_dust2\\nand\\2\\noplayers\\1\\linux\\1\\name_match\\goseq*",
+		"\\map\\de_dust2\\map\\de_inferno",
+		"\\nand\\0\\secure\\1",
+	}
+
+	for _, in := range inputs {
+		fil, err := ParseFilter(in)
+		if err != nil {
+			t.Log("Unexpected error parsing", in, ":", err)
+			t.FailNow()
+		}
+		expected := strings.TrimSuffix(in, "\x00") + "\x00"
+		if string(fil.GetFilterFormat()) != expected {
+			t.Log("Expected:", expected)
+			t.Log("Got:", string(fil.GetFilterFormat()))
+			t.FailNow()
+		}
+	}
+
+	built := NewFilterBuilder().AppID(440).Nor(func(g *FilterBuilder) {
+		g.Map("ctf_2fort").Proxy()
+	}).Filter()
+	fil, err := ParseFilter(string(built.GetFilterFormat()))
+	if err != nil || !reflect.DeepEqual(fil, built) {
+		t.Log("Expected the builder's filter back, got", fil, err)
+		t.FailNow()
+	}
+}
+
+func TestParseFilter_malformed(t *testing.T) {
+	inputs := map[string]int{
+		"appid\\730":                 0,
+		"\\appid\\730\\bogus\\1":     11,
+		"\\appid\\seven":             7,
+		"\\empty\\2":                 7,
+		"\\appid":                    6,
+		"\\appid\\730\\":             11,
+		"\\nor\\x\\map\\de_dust2":    5,
+		"\\nor\\3\\map\\a\\map\\b":   18,
+		"\\nor\\1\\nand\\1\\empty\\": 20,
+	}
+
+	for in, pos := range inputs {
+		_, err := ParseFilter(in)
+		serr, ok := err.(*FilterSyntaxError)
+		if !ok || !errors.Is(err, FilterMalformed) {
+			t.Log("Expected a FilterSyntaxError for", in, "got", err)
+			t.FailNow()
+		}
+		if serr.Pos != pos {
+			t.Log("Expected position", pos, "for", in, "got", serr)
+			t.FailNow()
+		}
+	}
+}
+
+// a Filter of the caller's own
+type wrappedFilter struct {
+	Filter
+}
+
+func TestFilter_Set_group(t *testing.T) {
+	maps := NewFilterBuilder().Map("de_dust2").Map("de_nuke").Filter()
+
+	fil := NewFilter()
+	if err := fil.Set("nor", maps); err != nil {
+		t.Log("Unexpected error on a Filter value:", err)
+		t.FailNow()
+	}
+	if err := fil.Set("nand", wrappedFilter{NewFilterBuilder().Linux().Secure().Filter()}); err != nil {
+		t.Log("Unexpected error on a Filter value:", err)
+		t.FailNow()
+	}
+
+	expected := "\\nor\\2\\map\\de_dust2\\map\\de_nuke\\nand\\2\\linux\\1\\secure\\1\x00"
+	if got := string(fil.GetFilterFormat()); got != expected {
+		t.Logf("Expected %q, got %q.", expected, got)
+		t.FailNow()
+	}
+
+	if group, _ := fil.Get("nor"); group != maps {
+		t.Log("Expected the group back as a Filter, got", group)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,125 @@
+package goseq
+
+import (
+	"strings"
+)
+
+// FilterBuilder assembles a Filter from the conditions documented for
+// the master server query protocol, in the order they are added.
+// Every method returns the builder so that calls can be chained:
+//
+//	NewFilterBuilder().AppID(730).Dedicated().Nor(func(g *FilterBuilder) {
+//		g.Map("de_dust2").Map("de_inferno")
+//	}).Filter()
+type FilterBuilder struct {
+	f *msfilter
+}
+
+// NewFilterBuilder returns a builder with no conditions.
+func NewFilterBuilder() *FilterBuilder {
+	return &FilterBuilder{f: newmsfilter()}
+}
+
+// Filter returns the filter built so far.
+func (b *FilterBuilder) Filter() Filter { return b.f }
+
+// add appends a condition. Unlike Filter.Set, the same key may
+// appear more than once, as the protocol allows.
+func (b *FilterBuilder) add(key string, value interface{}) *FilterBuilder {
+	b.f.parameters = append(b.f.parameters, filterParam{key, value})
+	return b
+}
+
+// group adds a nor or nand group holding the conditions build adds.
+func (b *FilterBuilder) group(key string, build func(*FilterBuilder)) *FilterBuilder {
+	g := NewFilterBuilder()
+	build(g)
+	return b.add(key, g.f)
+}
+
+// Nor excludes servers matching any of the conditions build adds.
+func (b *FilterBuilder) Nor(build func(*FilterBuilder)) *FilterBuilder {
+	return b.group("nor", build)
+}
+
+// Nand excludes servers matching all of the conditions build adds.
+func (b *FilterBuilder) Nand(build func(*FilterBuilder)) *FilterBuilder {
+	return b.group("nand", build)
+}
+
+// Dedicated keeps dedicated servers only.
+func (b *FilterBuilder) Dedicated() *FilterBuilder { return b.add("dedicated", true) }
+
+// Secure keeps servers using anti-cheat technology (VAC) only.
+func (b *FilterBuilder) Secure() *FilterBuilder { return b.add("secure", true) }
+
+// GameDir keeps servers running the given mod, eg "cstrike".
+func (b *FilterBuilder) GameDir(dir string) *FilterBuilder { return b.add("gamedir", dir) }
+
+// Map keeps servers running the given map.
+func (b *FilterBuilder) Map(name string) *FilterBuilder { return b.add("map", name) }
+
+// Linux keeps servers running on a Linux platform only.
+func (b *FilterBuilder) Linux() *FilterBuilder { return b.add("linux", true) }
+
+// NoPassword keeps servers that are not password protected.
+func (b *FilterBuilder) NoPassword() *FilterBuilder { return b.add("password", false) }
+
+// NotEmpty keeps servers that are not empty.
+func (b *FilterBuilder) NotEmpty() *FilterBuilder { return b.add("empty", true) }
+
+// NotFull keeps servers that are not full.
+func (b *FilterBuilder) NotFull() *FilterBuilder { return b.add("full", true) }
+
+// Proxy keeps servers that are spectator proxies only.
+func (b *FilterBuilder) Proxy() *FilterBuilder { return b.add("proxy", true) }
+
+// AppID keeps servers running the given app.
+func (b *FilterBuilder) AppID(appID int) *FilterBuilder { return b.add("appid", appID) }
+
+// NotAppID drops servers running the given app.
+func (b *FilterBuilder) NotAppID(appID int) *FilterBuilder { return b.add("napp", appID) }
+
+// NoPlayers keeps servers that are empty.
+func (b *FilterBuilder) NoPlayers() *FilterBuilder { return b.add("noplayers", true) }
+
+// White keeps whitelisted servers only.
+func (b *FilterBuilder) White() *FilterBuilder { return b.add("white", true) }
+
+// GameType keeps servers with all of the given tags in sv_tags.
+func (b *FilterBuilder) GameType(tags ...string) *FilterBuilder {
+	return b.add("gametype", strings.Join(tags, ","))
+}
+
+// GameData keeps servers with all of the given tags in their
+// hidden tags (L4D2).
+func (b *FilterBuilder) GameData(tags ...string) *FilterBuilder {
+	return b.add("gamedata", strings.Join(tags, ","))
+}
+
+// GameDataOr keeps servers with any of the given tags in their
+// hidden tags (L4D2).
+func (b *FilterBuilder) GameDataOr(tags ...string) *FilterBuilder {
+	return b.add("gamedataor", strings.Join(tags, ","))
+}
+
+// NameMatch keeps servers whose hostname matches pattern,
+// which may contain "*" wildcards.
+func (b *FilterBuilder) NameMatch(pattern string) *FilterBuilder {
+	return b.add("name_match", pattern)
+}
+
+// VersionMatch keeps servers whose version matches pattern,
+// which may contain "*" wildcards.
+func (b *FilterBuilder) VersionMatch(pattern string) *FilterBuilder {
+	return b.add("version_match", pattern)
+}
+
+// CollapseAddrHash returns only one server for each unique IP address.
+func (b *FilterBuilder) CollapseAddrHash() *FilterBuilder {
+	return b.add("collapse_addr_hash", true)
+}
+
+// GameAddr keeps servers on the given IP address; a port may be
+// added, as in "1.2.3.4:27015".
+func (b *FilterBuilder) GameAddr(addr string) *FilterBuilder { return b.add("gameaddr", addr) }
@@ -0,0 +1,183 @@
+package goseq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	FilterMalformed error = errors.New("Filter string is malformed.")
+)
+
+// FilterSyntaxError is returned by ParseFilter for input it can't
+// make sense of. It matches FilterMalformed with errors.Is.
+type FilterSyntaxError struct {
+	// Pos is the byte offset in the input where the problem starts.
+	Pos int
+	Msg string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("Filter string is malformed at position %d: %s.", e.Pos, e.Msg)
+}
+
+func (e *FilterSyntaxError) Is(target error) bool { return target == FilterMalformed }
+
+type filterKind int
+
+const (
+	filterBool filterKind = iota
+	filterInt
+	filterString
+	filterGroup
+)
+
+// filterKeys are the keys Valve's masters understand,
+// and the type of value each of them takes.
+var filterKeys = map[string]filterKind{
+	"dedicated":          filterBool,
+	"secure":             filterBool,
+	"linux":              filterBool,
+	"password":           filterBool,
+	"empty":              filterBool,
+	"full":               filterBool,
+	"proxy":              filterBool,
+	"noplayers":          filterBool,
+	"white":              filterBool,
+	"collapse_addr_hash": filterBool,
+	"appid":              filterInt,
+	"napp":               filterInt,
+	"gamedir":            filterString,
+	"map":                filterString,
+	"gametype":           filterString,
+	"gamedata":           filterString,
+	"gamedataor":         filterString,
+	"name_match":         filterString,
+	"version_match":      filterString,
+	"gameaddr":           filterString,
+	"nor":                filterGroup,
+	"nand":               filterGroup,
+}
+
+// ParseFilter turns a filter string in the format GetFilterFormat
+// writes, such as `\appid\730\nor\2\map\de_dust2\empty\1`, back into
+// a Filter. The NULL terminator is optional. A group's number is the
+// count of conditions directly inside it, a nested group counting
+// as one. Unknown keys and values of the wrong type are errors, as
+// is a group that claims more conditions than follow it.
+//
+// Repeated keys are kept, so the Filter formats back to s.
+func ParseFilter(s string) (Filter, error) {
+	p := &filterParser{}
+	if err := p.split(strings.TrimSuffix(s, "\x00")); err != nil {
+		return nil, err
+	}
+
+	fil := newmsfilter()
+	if err := p.parse(fil, -1); err != nil {
+		return nil, err
+	}
+	return fil, nil
+}
+
+type filterToken struct {
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	tokens []filterToken
+	next   int
+	// offset just past the input, for errors at the end
+	end int
+}
+
+func (p *filterParser) fail(pos int, format string, args ...interface{}) error {
+	return &FilterSyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// split cuts s into the fields between backslashes.
+func (p *filterParser) split(s string) error {
+	p.end = len(s)
+	if s == "" {
+		return nil
+	}
+	if s[0] != '\\' {
+		return p.fail(0, "expected '\\', got %q", s[0])
+	}
+
+	pos := 1
+	for _, field := range strings.Split(s[1:], "\\") {
+		p.tokens = append(p.tokens, filterToken{field, pos})
+		pos += len(field) + 1
+	}
+	return nil
+}
+
+// parse adds count conditions to fil, or all that are left if count
+// is negative.
+func (p *filterParser) parse(fil *msfilter, count int) error {
+	for n := 0; count < 0 || n < count; n++ {
+		if p.next >= len(p.tokens) {
+			if count < 0 {
+				return nil
+			}
+			return p.fail(p.end, "group ends after %d of %d conditions", n, count)
+		}
+
+		key := p.tokens[p.next]
+		p.next++
+		if key.text == "" {
+			return p.fail(key.pos, "missing key")
+		}
+		kind, ok := filterKeys[key.text]
+		if !ok {
+			return p.fail(key.pos, "unknown key %q", key.text)
+		}
+
+		if p.next >= len(p.tokens) {
+			return p.fail(p.end, "missing value for %q", key.text)
+		}
+		val := p.tokens[p.next]
+		p.next++
+
+		value, err := p.value(key.text, kind, val)
+		if err != nil {
+			return err
+		}
+		fil.parameters = append(fil.parameters, filterParam{key.text, value})
+	}
+	return nil
+}
+
+func (p *filterParser) value(key string, kind filterKind, val filterToken) (interface{}, error) {
+	switch kind {
+	case filterBool:
+		switch val.text {
+		case "0":
+			return false, nil
+		case "1":
+			return true, nil
+		}
+		return nil, p.fail(val.pos, "%q takes 0 or 1, got %q", key, val.text)
+	case filterInt:
+		i, err := strconv.Atoi(val.text)
+		if err != nil {
+			return nil, p.fail(val.pos, "%q takes a number, got %q", key, val.text)
+		}
+		return i, nil
+	case filterGroup:
+		count, err := strconv.Atoi(val.text)
+		if err != nil || count < 0 {
+			return nil, p.fail(val.pos, "%q takes a count of conditions, got %q", key, val.text)
+		}
+		group := newmsfilter()
+		if err := p.parse(group, count); err != nil {
+			return nil, err
+		}
+		return group, nil
+	}
+	return val.text, nil
+}
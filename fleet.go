@@ -0,0 +1,122 @@
+package goseq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FleetTarget is a server to run an RCON command on.
+type FleetTarget struct {
+	Address  string
+	Password string
+	// Engine picks the RCON protocol: TCP for SourceEngine,
+	// the legacy UDP one for GoldSrcEngine.
+	Engine Engine
+}
+
+// FleetOptions tunes ExecFleet. Zero fields fall back to
+// DefaultFleetOptions.
+type FleetOptions struct {
+	// Workers is how many servers are worked on at once.
+	Workers int
+	// Timeout bounds logging in and running the command on one server.
+	Timeout time.Duration
+}
+
+var (
+	DefaultFleetOptions FleetOptions = FleetOptions{
+		Workers: 16,
+		Timeout: 10 * time.Second,
+	}
+)
+
+func (o FleetOptions) orDefault() FleetOptions {
+	if o.Workers <= 0 {
+		o.Workers = DefaultFleetOptions.Workers
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultFleetOptions.Timeout
+	}
+	return o
+}
+
+// FleetResult is how the command went on one server.
+type FleetResult struct {
+	Address string
+	Output  string
+	// Latency is the time taken to log in and run the command.
+	Latency time.Duration
+	// Err is the *QueryError of the failed step, if any.
+	Err error
+}
+
+// FleetReport gathers the results of ExecFleet,
+// in the order of the targets.
+type FleetReport struct {
+	Command   string
+	Results   []FleetResult
+	Succeeded int
+	Failed    int
+}
+
+// ExecFleet runs command on every target, at most opts.Workers at a
+// time, and reports how it went on each. Targets not yet started
+// when ctx is done fail with its error.
+func ExecFleet(ctx context.Context, targets []FleetTarget, command string, opts FleetOptions) *FleetReport {
+	opts = opts.orDefault()
+	report := &FleetReport{Command: command, Results: make([]FleetResult, len(targets))}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Workers, len(targets)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Results[i] = execTarget(ctx, targets[i], command, opts.Timeout)
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Err != nil {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	return report
+}
+
+func execTarget(ctx context.Context, target FleetTarget, command string, timeout time.Duration) FleetResult {
+	result := FleetResult{Address: target.Address}
+	if err := ctx.Err(); err != nil {
+		result.Err = queryErr(target.Address, RCONRequest, err)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	dial := DialRCONContext
+	if target.Engine == GoldSrcEngine {
+		dial = DialGoldSrcRCONContext
+	}
+
+	rcon, err := dial(ctx, target.Address, target.Password)
+	if err == nil {
+		result.Output, err = rcon.ExecContext(ctx, command)
+		rcon.Close()
+	}
+	result.Latency = time.Since(start)
+	result.Err = err
+	return result
+}
@@ -0,0 +1,84 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecFleet(t *testing.T) {
+	var running, most atomic.Int32
+	handler := func(command string) string {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		return "ran " + command + "\n"
+	}
+
+	var targets []FleetTarget
+	for i := 0; i < 6; i++ {
+		targets = append(targets, FleetTarget{Address: newTestRCON(t, "hunter2", handler), Password: "hunter2"})
+	}
+	targets[2].Password = "wrong"
+
+	// a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	targets = append(targets, FleetTarget{Address: closed})
+
+	report := ExecFleet(context.Background(), targets, "changelevel de_dust2", FleetOptions{Workers: 2, Timeout: time.Second})
+
+	if report.Succeeded != 5 || report.Failed != 2 || len(report.Results) != 7 {
+		t.Log("Unexpected report:", report.Succeeded, report.Failed, len(report.Results))
+		t.FailNow()
+	}
+	for i, result := range report.Results {
+		if result.Address != targets[i].Address {
+			t.Log("Results are out of order at", i)
+			t.FailNow()
+		}
+		switch i {
+		case 2:
+			if !errors.Is(result.Err, RCONAuthFailed) {
+				t.Log("Expected RCONAuthFailed, got", result.Err)
+				t.FailNow()
+			}
+		case 6:
+			var qerr *QueryError
+			if !errors.As(result.Err, &qerr) || qerr.Stage != StageConnect {
+				t.Log("Expected a connect failure, got", result.Err)
+				t.FailNow()
+			}
+		default:
+			if result.Err != nil || result.Output != "ran changelevel de_dust2\n" || result.Latency <= 0 {
+				t.Log("Unexpected result:", result)
+				t.FailNow()
+			}
+		}
+	}
+
+	if most.Load() > 2 {
+		t.Log("Expected at most 2 servers at once, saw", most.Load())
+		t.FailNow()
+	}
+}
+
+func TestExecFleet_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := ExecFleet(ctx, []FleetTarget{{Address: "127.0.0.1:1"}}, "status", FleetOptions{})
+	if report.Failed != 1 || !errors.Is(report.Results[0].Err, context.Canceled) {
+		t.Log("Expected the target to fail with context.Canceled, got", report.Results[0].Err)
+		t.FailNow()
+	}
+}
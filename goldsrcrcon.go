@@ -0,0 +1,260 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tGoldSrcRCONRespID byte = 0x6C // "l"
+)
+
+var (
+	// GoldSrcRCONLinger is how long a GoldSrc RCON command waits
+	// for more output after the last datagram. The protocol has no
+	// way to tell the last datagram of a long output.
+	GoldSrcRCONLinger time.Duration = 100 * time.Millisecond
+)
+
+var (
+	// the replies of HLDS to a wrong password and a stale challenge
+	goldSrcBadPassword  = []byte("Bad rcon_password")
+	goldSrcBadChallenge = []byte("Bad challenge")
+)
+
+// goldSrcRCON speaks the UDP RCON of GoldSrc servers. The challenge
+// is tied to our source port, so the socket is kept open. Commands
+// take turns on it.
+type goldSrcRCON struct {
+	mu       sync.Mutex
+	src      sourceRemote
+	conn     net.Conn
+	closed   bool
+	password string
+	limits   Limits
+
+	challenge   string
+	challengeAt time.Time
+}
+
+// DialGoldSrcRCON readies the GoldSrc RCON of the server at
+// address. See DialGoldSrcRCONContext.
+func DialGoldSrcRCON(address, password string, timeout time.Duration) (RCON, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DialGoldSrcRCONContext(ctx, address, password)
+}
+
+// DialGoldSrcRCONContext readies the GoldSrc RCON of the server at
+// address, which is the address it answers queries on, by asking
+// it for a challenge. The challenge is reused for ChallengeLifetime.
+//
+// The password is only checked by the first command; a wrong one
+// fails with RCONAuthFailed. Output spread over several datagrams,
+// split or not, is joined together. A command whose context runs out
+// before the output is over fails with Timeout, the output received
+// so far being the QueryError's Payload.
+func DialGoldSrcRCONContext(ctx context.Context, address, password string) (RCON, error) {
+	r := &goldSrcRCON{password: password}
+	r.src.setAddress(address)
+
+	conn, err := r.src.connection()
+	if err != nil {
+		return nil, queryErr(address, RCONRequest, err)
+	}
+	r.conn = conn
+
+	if err := r.fetchChallenge(ctx); err != nil {
+		conn.Close()
+		return nil, queryErr(address, RCONRequest, err)
+	}
+	return r, nil
+}
+
+func (r *goldSrcRCON) Address() string    { return r.src.address() }
+func (r *goldSrcRCON) SetLimits(l Limits) { r.mu.Lock(); r.limits = l; r.mu.Unlock() }
+
+func (r *goldSrcRCON) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return r.conn.Close()
+}
+
+func (r *goldSrcRCON) Exec(command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.ExecContext(ctx, command)
+}
+
+func (r *goldSrcRCON) ExecContext(ctx context.Context, command string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out, err := r.exec(ctx, command)
+	if err != nil {
+		return "", queryErr(r.Address(), RCONRequest, err)
+	}
+	return out, nil
+}
+
+// exec runs command, getting a fresh challenge first if the cached
+// one expired, and once more if the server turns it down.
+func (r *goldSrcRCON) exec(ctx context.Context, command string) (_ string, err error) {
+	release := bindContext(ctx, r.conn)
+	defer func() {
+		release()
+		if err != nil && (errors.Is(err, Timeout) || ctx.Err() != nil) {
+			// the rest of the output would be taken
+			// for that of the next command
+			r.redial()
+			return
+		}
+		r.conn.SetDeadline(time.Time{})
+	}()
+
+	for rechallenged := false; ; rechallenged = true {
+		if r.challengeAt.IsZero() || time.Since(r.challengeAt) > ChallengeLifetime {
+			if err := r.challengeRound(ctx); err != nil {
+				return "", err
+			}
+		}
+
+		out, err := r.send(ctx, command)
+		switch {
+		case err != nil:
+			return "", err
+		case bytes.HasPrefix(out, goldSrcBadPassword):
+			return "", stageErr(StageAuth, out, RCONAuthFailed)
+		case bytes.HasPrefix(out, goldSrcBadChallenge):
+			r.challengeAt = time.Time{}
+			if rechallenged {
+				return "", stageErr(StageChallenge, out, ChallengeFailed)
+			}
+			continue
+		}
+		return string(out), nil
+	}
+}
+
+// redial swaps the socket for a fresh one, leaving whatever the
+// server still sends to the old one. The challenge is tied to the
+// old source port, so the next command asks for a new one.
+func (r *goldSrcRCON) redial() {
+	r.conn.Close()
+	r.challengeAt = time.Time{}
+	if r.closed {
+		return
+	}
+	if conn, err := r.src.connection(); err == nil {
+		r.conn = conn
+	}
+}
+
+func (r *goldSrcRCON) fetchChallenge(ctx context.Context) error {
+	release := bindContext(ctx, r.conn)
+	defer func() {
+		release()
+		r.conn.SetDeadline(time.Time{})
+	}()
+	return r.challengeRound(ctx)
+}
+
+// challengeRound asks for a challenge on the bound socket.
+// The reply reads "challenge rcon <number>".
+func (r *goldSrcRCON) challengeRound(ctx context.Context) error {
+	request := append(packetHeader[0:], "challenge rcon\n"...)
+	if _, err := r.conn.Write(request); err != nil {
+		return stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+
+	payload, err := r.receive(ctx)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(bytes.TrimRight(payload, "\x00")))
+	if len(fields) != 3 || fields[0] != "challenge" || fields[1] != "rcon" {
+		return stageErr(StageChallenge, payload, ChallengeFailed)
+	}
+
+	r.challenge = fields[2]
+	r.challengeAt = time.Now()
+	return nil
+}
+
+// send runs command under the cached challenge and returns its
+// output, joined from as many datagrams as arrive before the
+// server has been quiet for GoldSrcRCONLinger. If the context's
+// deadline comes first, the output may not be over: it fails
+// with Timeout and what came so far.
+func (r *goldSrcRCON) send(ctx context.Context, command string) ([]byte, error) {
+	request := bytes.NewBuffer(append([]byte(nil), packetHeader[0:]...))
+	request.WriteString("rcon " + r.challenge + " \"" + r.password + "\" " + command + "\n")
+	if _, err := r.conn.Write(request.Bytes()); err != nil {
+		return nil, stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+
+	// lingering cuts the context's deadline short;
+	// put it back for whatever comes next
+	defer func() {
+		deadline, _ := ctx.Deadline()
+		r.conn.SetReadDeadline(deadline)
+	}()
+
+	limits := r.limits.orDefault()
+	var out []byte
+	// whether the read deadline is the linger's
+	// rather than the context's
+	lingering := false
+	for answered := false; ; answered = true {
+		payload, err := r.receive(ctx)
+		if err != nil {
+			switch {
+			case answered && errors.Is(err, Timeout) && lingering && ctx.Err() == nil:
+				// the server went quiet
+				return out, nil
+			case answered && errors.Is(err, Timeout):
+				return nil, stageErr(StageRead, out, Timeout)
+			}
+			return nil, err
+		}
+		if len(payload) == 0 || payload[0] != tGoldSrcRCONRespID {
+			return nil, stageErr(StageDecode, payload, PacketMalformed)
+		}
+
+		chunk := bytes.TrimRight(payload[1:], "\x00")
+		if err := checkLimit("MaxRCONResponse", limits.MaxRCONResponse, len(out)+len(chunk)); err != nil {
+			return nil, stageErr(StageRead, nil, err)
+		}
+		out = append(out, chunk...)
+
+		lingerUntil := time.Now().Add(GoldSrcRCONLinger)
+		deadline, ok := ctx.Deadline()
+		lingering = !ok || lingerUntil.Before(deadline)
+		if lingering {
+			r.conn.SetReadDeadline(lingerUntil)
+		} else {
+			r.conn.SetReadDeadline(deadline)
+		}
+	}
+}
+
+// receive returns the payload of the next response,
+// split or not, without its header.
+func (r *goldSrcRCON) receive(ctx context.Context) ([]byte, error) {
+	st := newPacketStreamFor(splitGoldSrc, MaxDatagramSize, r.limits)
+	if err := st.Gobble(r.conn); err != nil {
+		return nil, stageErr(StageRead, st.last, contextErr(ctx, err))
+	}
+
+	payload, err := st.GetFullPayload()
+	if err != nil {
+		return nil, stageErr(StageDecode, st.contiguous_payload(), err)
+	}
+	return payload, nil
+}
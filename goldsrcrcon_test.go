@@ -0,0 +1,195 @@
+package goseq
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestGoldSrcRCON answers like HLDS. Challenges are numbered from
+// 1000 and only the last one handed out is accepted; output is sent
+// with reply.
+func newTestGoldSrcRCON(t *testing.T, password string, reply func(command string) [][]byte) (*testResponder, *atomic.Int32) {
+	var issued atomic.Int32
+	issued.Store(999)
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		text := strings.TrimSpace(string(req[packetHeaderSz:]))
+		if text == "challenge rcon" {
+			n := issued.Add(1)
+			return [][]byte{[]byte("\xFF\xFF\xFF\xFFchallenge rcon " + strconv.Itoa(int(n)) + "\n\x00")}
+		}
+
+		// rcon <challenge> "<password>" <command>
+		fields := strings.SplitN(text, " ", 4)
+		if len(fields) < 4 || fields[0] != "rcon" {
+			return nil
+		}
+		if fields[1] != strconv.Itoa(int(issued.Load())) {
+			return [][]byte{[]byte("\xFF\xFF\xFF\xFFlBad challenge.\n\x00")}
+		}
+		if fields[2] != "\""+password+"\"" {
+			return [][]byte{[]byte("\xFF\xFF\xFF\xFFlBad rcon_password.\n\x00")}
+		}
+		return reply(fields[3])
+	})
+	return r, &issued
+}
+
+func testGoldSrcPrint(text string) []byte {
+	return []byte("\xFF\xFF\xFF\xFFl" + text + "\x00")
+}
+
+func TestGoldSrcRCON_Exec(t *testing.T) {
+	long := strings.Repeat("0123456789", 50)
+	r, issued := newTestGoldSrcRCON(t, "hunter2", func(command string) [][]byte {
+		switch command {
+		case "status":
+			// two plain datagrams
+			return [][]byte{testGoldSrcPrint("hostname: goseq\n"), testGoldSrcPrint("map     : crossfire\n")}
+		case "cvarlist":
+			payload := bytes.NewBuffer(nil)
+			payload.Write(packetHeader[0:])
+			payload.WriteString("l" + long + "\x00")
+			return testSplitGoldSrc(3, payload.Bytes(), 100)
+		}
+		return [][]byte{testGoldSrcPrint("Unknown command: " + command + "\n")}
+	})
+
+	rcon, err := DialGoldSrcRCON(r.Address(), "hunter2", time.Second)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	defer rcon.Close()
+
+	out, err := rcon.Exec("status", time.Second)
+	if err != nil || out != "hostname: goseq\nmap     : crossfire\n" {
+		t.Log("Expected both datagrams joined, got", out, err)
+		t.FailNow()
+	}
+	out, err = rcon.Exec("cvarlist", time.Second)
+	if err != nil || out != long {
+		t.Log("Expected the split output joined, got", len(out), err)
+		t.FailNow()
+	}
+	if issued.Load() != 1000 {
+		t.Log("Expected the challenge to be reused, got", issued.Load()-999, "challenges")
+		t.FailNow()
+	}
+
+	// a challenge the server no longer accepts is replaced
+	issued.Add(5)
+	if out, err = rcon.Exec("echo", time.Second); err != nil || out != "Unknown command: echo\n" {
+		t.Log("Expected a fresh challenge to be fetched, got", out, err)
+		t.FailNow()
+	}
+}
+
+func TestGoldSrcRCON_badPassword(t *testing.T) {
+	r, _ := newTestGoldSrcRCON(t, "hunter2", func(string) [][]byte { return nil })
+
+	rcon, err := DialGoldSrcRCON(r.Address(), "wrong", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcon.Close()
+
+	_, err = rcon.Exec("status", time.Second)
+	var qerr *QueryError
+	if !errors.Is(err, RCONAuthFailed) || !errors.As(err, &qerr) || qerr.Stage != StageAuth {
+		t.Log("Expected RCONAuthFailed, got", err)
+		t.FailNow()
+	}
+}
+
+func TestGoldSrcRCON_lingerPastDeadline(t *testing.T) {
+	r, _ := newTestGoldSrcRCON(t, "hunter2", func(command string) [][]byte {
+		return [][]byte{testGoldSrcPrint("hostname: goseq\n")}
+	})
+
+	linger := GoldSrcRCONLinger
+	GoldSrcRCONLinger = time.Minute
+	defer func() { GoldSrcRCONLinger = linger }()
+
+	rcon, err := DialGoldSrcRCON(r.Address(), "hunter2", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcon.Close()
+
+	// the deadline cuts the linger short; what came is in
+	// the error, and the next command gets a fresh socket
+	for i := 0; i < 2; i++ {
+		_, err := rcon.Exec("status", 200*time.Millisecond)
+		var qerr *QueryError
+		if !errors.As(err, &qerr) || !errors.Is(err, Timeout) || string(qerr.Payload) != "hostname: goseq\n" {
+			t.Log("Expected a Timeout with the output received before the deadline, got", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestGoldSrcRCON_outputPastDeadline(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		var buffer [1500]byte
+		for {
+			n, from, err := conn.ReadFromUDP(buffer[0:])
+			if err != nil {
+				return
+			}
+			text := strings.TrimSpace(string(buffer[packetHeaderSz:n]))
+			switch {
+			case text == "challenge rcon":
+				conn.WriteToUDP([]byte("\xFF\xFF\xFF\xFFchallenge rcon 1000\n\x00"), from)
+			case strings.HasSuffix(text, " status"):
+				// a datagram every 20ms, for longer than
+				// the command is given
+				go func() {
+					for i := 0; i < 10; i++ {
+						conn.WriteToUDP(testGoldSrcPrint("chunk\n"), from)
+						time.Sleep(20 * time.Millisecond)
+					}
+				}()
+			default:
+				conn.WriteToUDP(testGoldSrcPrint("hi\n"), from)
+			}
+		}
+	}()
+
+	linger := GoldSrcRCONLinger
+	GoldSrcRCONLinger = 150 * time.Millisecond
+	defer func() { GoldSrcRCONLinger = linger }()
+
+	rcon, err := DialGoldSrcRCON(conn.LocalAddr().String(), "hunter2", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcon.Close()
+
+	_, err = rcon.Exec("status", 100*time.Millisecond)
+	var qerr *QueryError
+	if !errors.As(err, &qerr) || !errors.Is(err, Timeout) || !bytes.HasPrefix(qerr.Payload, []byte("chunk\n")) {
+		t.Log("Expected a Timeout with the output received before the deadline, got", err)
+		t.FailNow()
+	}
+
+	// let the rest of the output come
+	time.Sleep(200 * time.Millisecond)
+
+	out, err := rcon.Exec("echo hi", time.Second)
+	if err != nil || out != "hi\n" {
+		t.Logf("Expected %q, got %q, %v.", "hi\n", out, err)
+		t.FailNow()
+	}
+}
@@ -2,8 +2,9 @@ package goseq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"time"
+	"unicode"
 )
 
 const (
@@ -14,7 +15,39 @@ const (
 	HAS_GAMEID        = 0x01
 )
 
-func (serv *iserver) Info(timeout time.Duration) (info ServerInfo, err error) {
+const (
+	tInfoPacketReqID  byte = 0x54 // "T"
+	tInfoPacketRespID byte = 0x49 // "I"
+	tChallengeRespID  byte = 0x41 // "A"
+	// Obsolete GoldSrc response, still sent by
+	// Half-Life 1 servers alongside or instead of "I".
+	tGoldSrcInfoRespID byte = 0x6D // "m"
+)
+
+// newInfoRequestBA builds an A2S_INFO request. Servers
+// that demand a challenge (S2C_CHALLENGE) expect the
+// challenge they handed out to be appended; pass -1
+// for the initial request.
+func newInfoRequestBA(chalValue int32) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 29))
+	buf.Write(packetHeader[0:])
+	buf.WriteByte(tInfoPacketReqID)
+	buf.WriteString("Source Engine Query\x00")
+	if chalValue != -1 {
+		binary.Write(buf, byteOrder, chalValue)
+	}
+	return buf.Bytes()
+}
+
+func (serv *iserver) InfoContext(ctx context.Context) (info ServerInfo, err error) {
+	err = serv.retry(ctx, func(ctx context.Context) error {
+		info, err = serv.get_info(ctx)
+		return err
+	})
+	return info, queryErr(serv.Address(), InfoRequest, err)
+}
+
+func (serv *iserver) get_info(ctx context.Context) (info ServerInfo, err error) {
 	info = NewServerInfo()
 
 	conn, err := serv.getConnection()
@@ -22,41 +55,23 @@ func (serv *iserver) Info(timeout time.Duration) (info ServerInfo, err error) {
 		return info, err
 	}
 	defer conn.Close()
+	defer bindContext(ctx, conn)()
 
-	outOfTime := make(chan bool)
-	done := make(chan bool)
-
-	request := []byte("\xFF\xFF\xFF\xFF\x54Source Engine Query\x00")
-	// a buffer of buffers for multi packet responses
-	var payload []byte
-
-	go func() {
-		time.Sleep(timeout)
-		outOfTime <- true
-	}()
+	payload, path, err := serv.handshake(ctx, conn, newInfoRequestBA, []byte{tInfoPacketRespID, tGoldSrcInfoRespID}, false)
+	if err != nil {
+		return info, err
+	}
+	reportFor(ctx).Handshake = path
 
-	go func() {
-		conn.Write(request)
-		pks := newPacketStream()
-		err = pks.Gobble(conn) // yum yum
-		if err != nil {
-			done <- true
-		}
-		payload, err = pks.GetFullPayload()
-		done <- true
-	}()
-
-	select {
-	case <-outOfTime:
-		return info, Timeout
-	case <-done:
-		if err != nil {
-			return info, err
-		}
-		break
+	if err = info.decode(bytes.NewBuffer(payload)); err != nil {
+		err = stageErr(StageDecode, payload, err)
+		return
 	}
 
-	err = info.decode(bytes.NewBuffer(payload))
+	if info.GetEngine() == SourceEngine {
+		// remember the game for split quirks
+		serv.setGame(info.GetID(), info.Protocol)
+	}
 	return
 }
 
@@ -104,6 +119,24 @@ type wrInfExtra struct {
 	GameID        uint64 // if EDF & 0x01
 }
 
+// GoldSrc-only sections of the obsolete "m" response.
+type wrInfGoldSrc struct {
+	Address string
+	Mod     byte // is bool
+}
+
+type wrInfMod struct { // if Mod == 1
+	ModLink         string
+	ModDownloadLink string
+	ModStd          struct {
+		Null    byte
+		Version int32
+		Size    int32
+		Type    byte // 0 single and multiplayer, 1 multiplayer only
+		DLL     byte // 0 Half-Life DLL, 1 own DLL
+	}
+}
+
 // ServerInfo holds all the info values for a server.
 // Why is it composed so weird? Composition allows incrementally
 // decoding it from the payload while still allowing external
@@ -121,6 +154,11 @@ type ServerInfo struct {
 	wrInfStd4
 	// fields that depend on the flags in EDF
 	wrInfExtra
+	// only in GoldSrc "m" responses
+	wrInfGoldSrc
+	wrInfMod
+
+	engine Engine
 }
 
 func (s *ServerInfo) GetName() string   { return s.wrInfStd2.Name }
@@ -152,6 +190,20 @@ func (s *ServerInfo) GetSpectatorName() string { return s.wrInfExtra.SpectatorNa
 func (s *ServerInfo) GetKeywords() string      { return s.wrInfExtra.Keywords }
 func (s *ServerInfo) GetGameID() uint64        { return s.wrInfExtra.GameID }
 
+// GetEngine reports which response format the server
+// answered with.
+func (s *ServerInfo) GetEngine() Engine { return s.engine }
+
+// GoldSrc "m" responses only.
+func (s *ServerInfo) GetAddress() string         { return s.wrInfGoldSrc.Address }
+func (s *ServerInfo) IsMod() bool                { return s.wrInfGoldSrc.Mod == 1 }
+func (s *ServerInfo) GetModLink() string         { return s.wrInfMod.ModLink }
+func (s *ServerInfo) GetModDownloadLink() string { return s.wrInfMod.ModDownloadLink }
+func (s *ServerInfo) GetModVersion() int32       { return s.wrInfMod.ModStd.Version }
+func (s *ServerInfo) GetModSize() int32          { return s.wrInfMod.ModStd.Size }
+func (s *ServerInfo) GetModType() byte           { return s.wrInfMod.ModStd.Type }
+func (s *ServerInfo) GetModDLL() byte            { return s.wrInfMod.ModStd.DLL }
+
 func NewServerInfo() ServerInfo {
 	return ServerInfo{}
 }
@@ -161,7 +213,11 @@ func (p *ServerInfo) decode(stream *bytes.Buffer) (err error) {
 		return
 	}
 
-	if p.wrInfHead.Header != byte('I') {
+	if p.wrInfHead.Header == tGoldSrcInfoRespID {
+		return p.decodeGoldSrc(stream)
+	}
+
+	if p.wrInfHead.Header != tInfoPacketRespID {
 		return PacketMalformed
 	}
 
@@ -228,3 +284,62 @@ func (p *ServerInfo) decode(stream *bytes.Buffer) (err error) {
 	}
 	return nil
 }
+
+// decodeGoldSrc decodes the body of an obsolete GoldSrc "m"
+// response into the fields shared with the Source format.
+func (p *ServerInfo) decodeGoldSrc(stream *bytes.Buffer) (err error) {
+	p.engine = GoldSrcEngine
+
+	str2decode := []*string{&p.Address, &p.Name, &p.Map, &p.Folder, &p.Game}
+
+	for _, loc := range str2decode {
+		if *loc, err = rcstr(stream); err != nil {
+			return
+		}
+	}
+
+	var std struct {
+		Players     uint8
+		MaxPlayers  uint8
+		Protocol    byte
+		Servertype  ServerType
+		Environment byte
+		Visibility  byte
+		Mod         byte
+	}
+	if err = binary.Read(stream, byteOrder, &std); err != nil {
+		return
+	}
+
+	p.Players = std.Players
+	p.MaxPlayers = std.MaxPlayers
+	p.Protocol = std.Protocol
+	p.Servertype = std.Servertype
+	// GoldSrc reports environments in upper case
+	p.Environment = byte(unicode.ToLower(rune(std.Environment)))
+	p.Visibility = std.Visibility
+	p.Mod = std.Mod
+
+	if p.Mod == 1 {
+		if p.ModLink, err = rcstr(stream); err != nil {
+			return
+		}
+		if p.ModDownloadLink, err = rcstr(stream); err != nil {
+			return
+		}
+		if err = binary.Read(stream, byteOrder, &p.ModStd); err != nil {
+			return
+		}
+	}
+
+	var tail struct {
+		VAC  byte
+		Bots uint8
+	}
+	if err = binary.Read(stream, byteOrder, &tail); err != nil {
+		return
+	}
+	p.VAC = tail.VAC
+	p.Bots = tail.Bots
+	return nil
+}
@@ -0,0 +1,126 @@
+package goseq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testInfoResponse is a complete, unsplit A2S_INFO reply.
+func testInfoResponse() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(packetHeader[0:])
+	buf.WriteByte(tInfoPacketRespID)
+	buf.WriteByte(17) // protocol
+	buf.WriteString("goseq test server\x00")
+	buf.WriteString("de_dust2\x00")
+	buf.WriteString("csgo\x00")
+	buf.WriteString("Counter-Strike: Global Offensive\x00")
+	binary.Write(buf, byteOrder, wrInfStd3{
+		ID:          730,
+		Players:     12,
+		MaxPlayers:  24,
+		Bots:        2,
+		Servertype:  Dedicated,
+		Environment: byte(Linux),
+		Visibility:  0,
+		VAC:         1,
+	})
+	buf.WriteString("1.38.2.2\x00")
+	buf.WriteByte(HAS_PORT | HAS_KEYWORDS)
+	binary.Write(buf, byteOrder, uint16(27015))
+	buf.WriteString("secure,valve_ds\x00")
+	return buf.Bytes()
+}
+
+func testChallengeResponse(chalValue int32) []byte {
+	return newWrappedChallengeBA(tChallengeRespID, chalValue)
+}
+
+func checkTestInfo(t *testing.T, info ServerInfo) {
+	if info.GetName() != "goseq test server" || info.GetMap() != "de_dust2" {
+		t.Log("Info strings decoded incorrectly:", info.GetName(), info.GetMap())
+		t.FailNow()
+	}
+	if info.GetID() != 730 || info.GetPlayers() != 12 || info.GetPort() != 27015 {
+		t.Log("Info numbers decoded incorrectly:", info.GetID(), info.GetPlayers(), info.GetPort())
+		t.FailNow()
+	}
+	if info.GetKeywords() != "secure,valve_ds" {
+		t.Log("Keywords decoded incorrectly:", info.GetKeywords())
+		t.FailNow()
+	}
+}
+
+func TestServer_Info_direct(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testInfoResponse()}
+	})
+
+	info, err := r.Server().Info(time.Second)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	checkTestInfo(t, info)
+}
+
+func TestServer_Info_challenge(t *testing.T) {
+	const chalValue int32 = 0x1234ABCD
+	plain := newInfoRequestBA(-1)
+	redeemed := newInfoRequestBA(chalValue)
+
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		switch {
+		case bytes.Equal(req, redeemed):
+			return [][]byte{testInfoResponse()}
+		case bytes.Equal(req, plain):
+			return [][]byte{testChallengeResponse(chalValue)}
+		}
+		return nil
+	})
+
+	info, err := r.Server().Info(time.Second)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	checkTestInfo(t, info)
+}
+
+func TestServer_Info_challengeRejected(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testChallengeResponse(42)}
+	})
+
+	_, err := r.Server().Info(time.Second)
+	if !errors.Is(err, ChallengeFailed) {
+		t.Log("Expected ChallengeFailed, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestServer_Info_queryError(t *testing.T) {
+	garbage := []byte("\xFF\xFF\xFF\xFF\x49\x11not enough")
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{garbage}
+	})
+
+	_, err := r.Server().Info(time.Second)
+
+	var qerr *QueryError
+	if !errors.As(err, &qerr) {
+		t.Log("Expected a QueryError, got:", err)
+		t.FailNow()
+	}
+	if qerr.Addr != r.Address() || qerr.Request != InfoRequest || qerr.Stage != StageDecode {
+		t.Log("QueryError has the wrong context:", qerr.Addr, qerr.Request, qerr.Stage)
+		t.FailNow()
+	}
+	if !bytes.Equal(qerr.Payload, garbage[packetHeaderSz:]) {
+		t.Log("QueryError has the wrong payload:", qerr.Payload)
+		t.FailNow()
+	}
+}
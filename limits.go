@@ -0,0 +1,83 @@
+package goseq
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	LimitExceeded error = errors.New("Response exceeds a configured limit.")
+)
+
+// Limits caps how much memory a response may make us allocate.
+// Servers listed by a master are untrusted; without caps a hostile
+// one can claim gigabytes of compressed data or thousands of split
+// packets. A zero field falls back to DefaultLimits.
+type Limits struct {
+	// MaxDecompressedSize is the largest payload, in bytes,
+	// a compressed response may inflate to.
+	MaxDecompressedSize int
+	// MaxSplitPackets is the largest Total a split response may claim.
+	MaxSplitPackets int
+	// MaxPlayers is the most players a players response may list.
+	MaxPlayers int
+	// MaxRules is the most rules a rules response may list.
+	MaxRules int
+	// MaxRCONResponse is the largest output, in bytes, an RCON
+	// command may return.
+	MaxRCONResponse int
+}
+
+var (
+	// DefaultLimits are generous for any real server.
+	DefaultLimits Limits = Limits{
+		MaxDecompressedSize: 1024 * 1024,
+		MaxSplitPackets:     64,
+		MaxPlayers:          255,
+		MaxRules:            4096,
+		MaxRCONResponse:     4 * 1024 * 1024,
+	}
+)
+
+// LimitError is returned when a response exceeds one of the Limits.
+// It matches LimitExceeded with errors.Is.
+type LimitError struct {
+	// Limit names the field of Limits that was exceeded.
+	Limit string
+	Max   int
+	Got   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Response exceeds %s: %d > %d.", e.Limit, e.Got, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool { return target == LimitExceeded }
+
+// orDefault fills the zero fields of l from DefaultLimits.
+func (l Limits) orDefault() Limits {
+	if l.MaxDecompressedSize <= 0 {
+		l.MaxDecompressedSize = DefaultLimits.MaxDecompressedSize
+	}
+	if l.MaxSplitPackets <= 0 {
+		l.MaxSplitPackets = DefaultLimits.MaxSplitPackets
+	}
+	if l.MaxPlayers <= 0 {
+		l.MaxPlayers = DefaultLimits.MaxPlayers
+	}
+	if l.MaxRules <= 0 {
+		l.MaxRules = DefaultLimits.MaxRules
+	}
+	if l.MaxRCONResponse <= 0 {
+		l.MaxRCONResponse = DefaultLimits.MaxRCONResponse
+	}
+	return l
+}
+
+// checkLimit returns a LimitError if got is above max.
+func checkLimit(limit string, max, got int) error {
+	if got > max {
+		return &LimitError{Limit: limit, Max: max, Got: got}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package goseq
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tLogPlainID  byte = 0x52 // "R"
+	tLogSecretID byte = 0x53 // "S"
+)
+
+var (
+	// GoldSrc servers send "log L ..." instead of a marker.
+	goldSrcLogPrefix = []byte("log ")
+)
+
+// LogLine is a line a server sent to a LogListener.
+type LogLine struct {
+	// Addr is the address the line came from, which is the
+	// address the server answers queries on.
+	Addr string
+	// Line is the line as a server writes it to its log files,
+	// eg `L 10/17/2026 - 12:00:00: "alice<2><[U:1:12345]><Red>" say "gg"`.
+	Line     string
+	Received time.Time
+}
+
+// LogOptions tunes a LogListener. Zero fields fall back to
+// DefaultLogOptions.
+type LogOptions struct {
+	// Secret is the sv_logsecret the servers were given. When set,
+	// lines without it are rejected; when not, lines are accepted
+	// whatever secret they carry.
+	Secret string
+	// Buffer is how many lines may wait to be read before new
+	// ones are dropped. Reading the socket never waits on the reader.
+	Buffer int
+}
+
+var (
+	DefaultLogOptions LogOptions = LogOptions{
+		Buffer: 1024,
+	}
+)
+
+// LogStats counts what a LogListener did with the datagrams it got.
+type LogStats struct {
+	Received int64
+	// Rejected are the datagrams that weren't log lines
+	// or carried the wrong secret.
+	Rejected int64
+	// Dropped are the lines that didn't fit in the buffer.
+	Dropped int64
+}
+
+// LogListener receives the log lines servers stream to it over UDP
+// after a `logaddress_add <host>:<port>`, Source and GoldSrc alike.
+type LogListener struct {
+	conn   *net.UDPConn
+	secret []byte
+	lines  chan LogLine
+
+	received, rejected, dropped atomic.Int64
+}
+
+// ListenLogs binds a LogListener to address, eg ":27500".
+// Close it to stop.
+func ListenLogs(address string, opts LogOptions) (*LogListener, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultLogOptions.Buffer
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LogListener{
+		conn:   conn,
+		secret: []byte(opts.Secret),
+		lines:  make(chan LogLine, opts.Buffer),
+	}
+	go l.listen()
+	return l, nil
+}
+
+// Lines delivers the lines received, in the order they arrived.
+// It is closed once the listener is closed.
+func (l *LogListener) Lines() <-chan LogLine { return l.lines }
+
+// Addr is the address the listener is bound to.
+func (l *LogListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+func (l *LogListener) Close() error { return l.conn.Close() }
+
+func (l *LogListener) Stats() LogStats {
+	return LogStats{
+		Received: l.received.Load(),
+		Rejected: l.rejected.Load(),
+		Dropped:  l.dropped.Load(),
+	}
+}
+
+func (l *LogListener) listen() {
+	defer close(l.lines)
+
+	buffer := make([]byte, MaxDatagramSize)
+	for {
+		n, from, err := l.conn.ReadFromUDPAddrPort(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		l.received.Add(1)
+
+		line, ok := l.parse(buffer[0:n])
+		if !ok {
+			l.rejected.Add(1)
+			continue
+		}
+
+		from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+		select {
+		case l.lines <- LogLine{Addr: from.String(), Line: line, Received: time.Now()}:
+		default:
+			l.dropped.Add(1)
+		}
+	}
+}
+
+// parse returns the line carried by datagram, which reads
+//
+//	\xFF\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: ...
+//	\xFF\xFF\xFF\xFFS<secret>L 10/17/2026 - 12:00:00: ...
+//	\xFF\xFF\xFF\xFFlog L 10/17/2026 - 12:00:00: ...
+//
+// The last is how GoldSrc servers send them; they have no secret.
+func (l *LogListener) parse(datagram []byte) (string, bool) {
+	body, ok := bytes.CutPrefix(datagram, packetHeader[0:])
+	if !ok || len(body) == 0 {
+		return "", false
+	}
+
+	var secret []byte
+	switch {
+	case body[0] == tLogPlainID:
+		body = body[1:]
+	case body[0] == tLogSecretID:
+		// the secret runs up to the "L " starting the line
+		i := bytes.Index(body, []byte("L "))
+		if i < 0 {
+			return "", false
+		}
+		secret, body = body[1:i], body[i:]
+	case bytes.HasPrefix(body, goldSrcLogPrefix):
+		body = body[len(goldSrcLogPrefix):]
+	default:
+		return "", false
+	}
+
+	if len(l.secret) > 0 && !bytes.Equal(secret, l.secret) {
+		return "", false
+	}
+	if !bytes.HasPrefix(body, []byte("L ")) {
+		return "", false
+	}
+	return string(bytes.TrimRight(body, "\x00\r\n")), true
+}
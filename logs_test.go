@@ -0,0 +1,99 @@
+package goseq
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func testLogSend(t *testing.T, conn net.Conn, datagram string) {
+	if _, err := conn.Write([]byte(datagram)); err != nil {
+		t.Log("Write:", err)
+		t.FailNow()
+	}
+}
+
+func testLogLine(t *testing.T, l *LogListener) LogLine {
+	select {
+	case line := <-l.Lines():
+		return line
+	case <-time.After(2 * time.Second):
+		t.Log("No line received.")
+		t.FailNow()
+	}
+	return LogLine{}
+}
+
+func TestLogListener_Lines(t *testing.T) {
+	l, err := ListenLogs("127.0.0.1:0", LogOptions{Secret: "31337"})
+	if err != nil {
+		t.Log("ListenLogs:", err)
+		t.FailNow()
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	if err != nil {
+		t.Log("Dial:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	testLogSend(t, conn, "\xFF\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: no secret\n\x00")
+	testLogSend(t, conn, "\xFF\xFF\xFF\xFFS1234L 10/17/2026 - 12:00:01: wrong secret\n\x00")
+	testLogSend(t, conn, "not a log line")
+	testLogSend(t, conn, "\xFF\xFF\xFF\xFFS31337L 10/17/2026 - 12:00:02: \"alice<2><[U:1:12345]><Red>\" say \"gg\"\n\x00")
+
+	line := testLogLine(t, l)
+	want := `L 10/17/2026 - 12:00:02: "alice<2><[U:1:12345]><Red>" say "gg"`
+	if line.Line != want {
+		t.Logf("Expected %q, got %q.", want, line.Line)
+		t.FailNow()
+	}
+	if line.Addr != conn.LocalAddr().String() {
+		t.Logf("Expected the line from %s, got %s.", conn.LocalAddr(), line.Addr)
+		t.FailNow()
+	}
+
+	if stats := l.Stats(); stats.Received != 4 || stats.Rejected != 3 || stats.Dropped != 0 {
+		t.Logf("Unexpected stats %+v.", stats)
+		t.FailNow()
+	}
+
+	l.Close()
+	select {
+	case _, ok := <-l.Lines():
+		if ok {
+			t.Log("Expected no more lines.")
+			t.FailNow()
+		}
+	case <-time.After(2 * time.Second):
+		t.Log("Lines was not closed.")
+		t.FailNow()
+	}
+}
+
+func TestLogListener_parse(t *testing.T) {
+	l := &LogListener{}
+	cases := []struct {
+		datagram string
+		line     string
+		ok       bool
+	}{
+		{"\xFF\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: plain\n\x00", "L 10/17/2026 - 12:00:00: plain", true},
+		{"\xFF\xFF\xFF\xFFS42L 10/17/2026 - 12:00:00: secret\n\x00", "L 10/17/2026 - 12:00:00: secret", true},
+		{"\xFF\xFF\xFF\xFFlog L 10/17/2026 - 12:00:00: goldsrc\n\x00", "L 10/17/2026 - 12:00:00: goldsrc", true},
+		{"\xFF\xFF\xFF\xFFR", "", false},
+		{"\xFF\xFF\xFF\xFFS42", "", false},
+		{"\xFF\xFF\xFF\xFFlhostname: goseq", "", false},
+		{"\xFF\xFF\xFFRL 10/17/2026 - 12:00:00: short header", "", false},
+	}
+
+	for _, c := range cases {
+		line, ok := l.parse([]byte(c.datagram))
+		if ok != c.ok || line != c.line {
+			t.Logf("%q: expected (%q, %v), got (%q, %v).", c.datagram, c.line, c.ok, line, ok)
+			t.FailNow()
+		}
+	}
+}
@@ -2,12 +2,14 @@ package goseq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"sync"
 	"time"
 )
 
@@ -48,9 +50,6 @@ var (
 		"208.64.200.117:27011",
 		"208.64.200.118:27011",
 	}
-	// which server we're going to use by default
-	favored_server int = 2
-
 	MasterServerTimeout time.Duration = 5 * time.Second
 )
 
@@ -58,10 +57,16 @@ var (
 	masterResponseHeader [masterRespHeaderLength]byte = [...]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x66, 0x0A}
 )
 
+// MasterServer lists the servers registered with Valve's masters.
+// Queries fail with a *QueryError.
 type MasterServer interface {
 	SetFilter(Filter) error
 	GetFilter() Filter
+	// SetAddr makes queries start at the master at the given
+	// address; "" lets each of them start at the healthiest
+	// master of the pool, which is the default.
 	SetAddr(string) error
+	// GetAddr is the master the next query starts at.
 	GetAddr() string
 	SetRegion(Region)
 	GetRegion() Region
@@ -69,37 +74,98 @@ type MasterServer interface {
 	// with startIP.
 	// Returned servers are NOT guaranteed to work.
 	Query(startIP string) ([]Server, error)
+	// QueryContext is Query bounded by ctx. Each master is
+	// still given at most MasterServerTimeout to answer.
+	QueryContext(ctx context.Context, startIP string) ([]Server, error)
+	// Crawl pages through the whole listing, from Beggining
+	// until the master hands Beggining back.
+	Crawl(ctx context.Context, opts CrawlOptions) (*CrawlResult, error)
+	// CrawlStream is Crawl delivering servers as each page is
+	// decoded. The channel is unbuffered: the next page is not
+	// requested before the current one has been received. It is
+	// closed when the crawl ends, after an item carrying the error
+	// if the crawl failed, or as soon as ctx is done.
+	CrawlStream(ctx context.Context, opts CrawlOptions) <-chan CrawlItem
+	// CrawlRegions crawls several regions at once, AllRegions if
+	// none are given, and merges what they list. A region given
+	// twice is crawled once. Regions that fail
+	// are reported in the error, joined, while the servers of the
+	// others are still returned.
+	CrawlRegions(ctx context.Context, regions []Region, opts CrawlOptions) (*RegionCrawlResult, error)
 }
 
+// master is safe to share between goroutines. Every query runs
+// on a snapshot of its settings, see snapshot, with a socket of
+// its own.
 type master struct {
-	filter       Filter
-	addr         string
-	master_index int
-	region       Region
-	remoteAddr   *net.UDPAddr
-	remoteConn   *net.UDPConn
+	mu     sync.Mutex
+	filter Filter
+	// set by SetAddr, "" to start at the pool's best
+	addr   string
+	pool   *MasterPool
+	region Region
+	// only used by snapshots
+	remoteAddr *net.UDPAddr
+	remoteConn *net.UDPConn
 }
 
+// NewMasterServer returns a MasterServer that picks
+// its masters from DefaultMasterPool.
 func NewMasterServer() MasterServer {
+	return NewMasterServerFromPool(DefaultMasterPool())
+}
+
+// NewMasterServerFromPool returns a MasterServer whose queries
+// each start at the healthiest master of pool, move on to the next
+// healthiest when one goes silent, and report back to pool how each
+// of them did.
+func NewMasterServerFromPool(pool *MasterPool) MasterServer {
 	return &master{
-		filter:       NewFilter(),
-		addr:         MasterSourceServers[favored_server],
-		master_index: favored_server,
-		region:       USWest,
-		remoteAddr:   nil,
-		remoteConn:   nil,
+		filter: NewFilter(),
+		pool:   pool,
+		region: USWest,
+	}
+}
+
+func (m *master) SetFilter(f Filter) error { m.mu.Lock(); m.filter = f; m.mu.Unlock(); return nil }
+func (m *master) GetFilter() Filter        { m.mu.Lock(); defer m.mu.Unlock(); return m.filter }
+func (m *master) SetRegion(i Region)       { m.mu.Lock(); m.region = i; m.mu.Unlock() }
+func (m *master) GetRegion() Region        { m.mu.Lock(); defer m.mu.Unlock(); return m.region }
+
+func (m *master) SetAddr(i string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addr = i
+	return nil
+}
+
+func (m *master) GetAddr() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.addr == "" {
+		return m.pool.Best()
 	}
+	return m.addr
 }
 
-func (m *master) SetFilter(f Filter) error { m.filter = f; return nil }
-func (m *master) GetFilter() Filter        { return m.filter }
-func (m *master) SetAddr(i string) error   { m.addr = i; m.remoteAddr = nil; return nil }
-func (m *master) GetAddr() string          { return m.addr }
-func (m *master) SetRegion(i Region)       { m.region = i }
-func (m *master) GetRegion() Region        { return m.region }
+// snapshot copies the settings of m for a single query, which may
+// then run without holding m.mu. The query starts at the master set
+// with SetAddr, or else at the one the pool deems healthiest right
+// now. Its socket must be released with closeConnection.
+func (m *master) snapshot() *master {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := &master{filter: m.filter, addr: m.addr, pool: m.pool, region: m.region}
+	if q.addr == "" {
+		q.addr = m.pool.Best()
+	}
+	return q
+}
 
 func (m *master) refreshConnection() (err error) {
 	if m.remoteAddr == nil || m.remoteConn == nil {
+		m.closeConnection()
 		m.remoteAddr, err = net.ResolveUDPAddr("udp", m.addr)
 		if err != nil {
 			m.remoteAddr = nil
@@ -114,6 +180,13 @@ func (m *master) refreshConnection() (err error) {
 	return nil
 }
 
+func (m *master) closeConnection() {
+	if m.remoteConn != nil {
+		m.remoteConn.Close()
+		m.remoteConn = nil
+	}
+}
+
 func (m *master) makerequest(ip string) []byte {
 	packet := bytes.NewBuffer([]byte{})
 	packet.WriteByte(0x31)
@@ -133,82 +206,63 @@ func (_ *master) ip2server(ip wireIP, serv *iserver) {
 }
 
 // try to write and read from the socket.
-func (m *master) try(request, buffer []byte) (error, int) {
-	timeout := make(chan bool, 1)
-	done := make(chan error, 1)
-	n := 0
-	var e error
-
-	go func() {
-		if e := m.refreshConnection(); e != nil {
-			done <- e
-			return
-		}
+// Any failure drops the connection so the next
+// attempt starts from a fresh socket.
+func (m *master) try(ctx context.Context, request, buffer []byte, timeout time.Duration) (error, int) {
+	if e := m.refreshConnection(); e != nil {
+		return stageErr(StageConnect, nil, e), 0
+	}
 
-		if _, e := m.remoteConn.Write(request); e != nil {
-			done <- e
-			return
-		}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	release := bindContext(ctx, m.remoteConn)
 
+	stage := StageWrite
+	_, e := m.remoteConn.Write(request)
+	n := 0
+	if e == nil {
+		stage = StageRead
 		n, e = m.remoteConn.Read(buffer)
-		if e != nil {
-			done <- e
-			return
-		}
-		done <- nil
-	}()
-
-	go func() {
-		time.Sleep(MasterServerTimeout)
-		timeout <- true
-	}()
-
-	select {
-	case e := <-done:
-		return e, n
-	case <-timeout:
-		return Timeout, 0
 	}
+
+	release()
+	if e != nil {
+		// the socket may be left with an expired
+		// deadline; don't reuse it.
+		m.closeConnection()
+		return stageErr(stage, nil, contextErr(ctx, e)), 0
+	}
+	// ctx may have run out once the reply was in; it's
+	// still whole, so keep it and clear the deadline.
+	m.remoteConn.SetDeadline(time.Time{})
+	return nil, n
 }
 
 func (m *master) Query(at string) ([]Server, error) {
-	reqpacket := m.makerequest(at)
-	respbuffer := [1024 * 1024 * 2]byte{} // 2MB, should be 400 bytes above max
-
-	var e error
-	var n int
-
-	start_indice := m.master_index
-	for {
-		e, n = m.try(reqpacket, respbuffer[0:])
-		if e == Timeout {
-			m.master_index = (m.master_index + 1) % len(MasterSourceServers)
-			m.addr = MasterSourceServers[m.master_index]
+	return m.QueryContext(context.Background(), at)
+}
 
-			if m.master_index == start_indice {
-				// we've come full circle, time to quit.
-				return nil, Timeout
-			}
+func (m *master) QueryContext(ctx context.Context, at string) ([]Server, error) {
+	q := m.snapshot()
+	defer q.closeConnection()
 
-			favored_server = m.master_index
-			m.remoteAddr = nil
-		} else if e != nil {
-			return nil, e
-		} else {
-			break
-		}
+	servers, err := q.query(ctx, at)
+	if err != nil {
+		return nil, queryErr(q.addr, MasterRequest, err)
 	}
+	return servers, nil
+}
 
-	resp := wireMasterResponse{}
-	err := resp.Decode(bytes.NewBuffer(respbuffer[0:n]), n)
+func (m *master) query(ctx context.Context, at string) ([]Server, error) {
+	ips, err := m.page(ctx, at, MasterServerTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	servers := make([]Server, len(resp.Ips))
+	servers := make([]Server, len(ips))
 
 	var iterated_server Server
-	for i, ip := range resp.Ips {
+	for i, ip := range ips {
 		iterated_server = NewServer()
 		iterated_server.SetAddress(ip.String())
 		servers[i] = iterated_server
@@ -217,6 +271,65 @@ func (m *master) Query(at string) ([]Server, error) {
 	return servers, nil
 }
 
+// page fetches the page of servers following the one at,
+// moving on to the next master whenever one stays silent
+// for longer than timeout.
+func (m *master) page(ctx context.Context, at string, timeout time.Duration) ([]wireIP, error) {
+	tried := map[string]bool{}
+	for {
+		ips, e := m.fetch(ctx, at, timeout)
+		if errors.Is(e, Timeout) && ctx.Err() == nil {
+			if !m.rotate(tried) {
+				// we've come full circle, time to quit.
+				return nil, e
+			}
+		} else {
+			return ips, e
+		}
+	}
+}
+
+// rotate moves on to the healthiest master not yet tried,
+// adding the current one to tried. It returns false once
+// every master of the pool has been tried.
+func (m *master) rotate(tried map[string]bool) bool {
+	tried[m.addr] = true
+
+	next := m.pool.best(tried)
+	if next == "" {
+		return false
+	}
+
+	m.addr = next
+	m.remoteAddr = nil
+	return true
+}
+
+// fetch asks the current master for the page
+// of servers following the one at.
+func (m *master) fetch(ctx context.Context, at string, timeout time.Duration) ([]wireIP, error) {
+	reqpacket := m.makerequest(at)
+	respbuffer := make([]byte, MaxDatagramSize)
+
+	start := time.Now()
+	e, n := m.try(ctx, reqpacket, respbuffer, timeout)
+	if e != nil {
+		if ctx.Err() == nil {
+			m.pool.report(m.addr, 0, e)
+		}
+		return nil, e
+	}
+
+	resp := wireMasterResponse{}
+	err := resp.Decode(bytes.NewBuffer(respbuffer[0:n]), n)
+	m.pool.report(m.addr, time.Since(start), err)
+	if err != nil {
+		return nil, stageErr(StageDecode, respbuffer[0:n], err)
+	}
+
+	return resp.Ips, nil
+}
+
 // Incoming IPs as represented on the wire.
 type wireIP struct {
 	Oct struct {
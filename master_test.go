@@ -0,0 +1,382 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testMasterPage encodes a master response listing addrs,
+// given as "a.b.c.d:port".
+func testMasterPage(addrs ...string) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(masterResponseHeader[0:])
+	for _, addr := range addrs {
+		var o1, o2, o3, o4 byte
+		var port uint16
+		fmt.Sscanf(addr, "%d.%d.%d.%d:%d", &o1, &o2, &o3, &o4, &port)
+		buf.Write([]byte{o1, o2, o3, o4})
+		binary.Write(buf, binary.BigEndian, port)
+	}
+	return buf.Bytes()
+}
+
+// testMasterSeed returns the seed address of a master request.
+func testMasterSeed(req []byte) string {
+	if len(req) < 3 {
+		return ""
+	}
+	seed, _, _ := bytes.Cut(req[2:], []byte{0})
+	return string(seed)
+}
+
+// newTestMaster serves pages keyed by the seed that requests them.
+func newTestMaster(t *testing.T, pages map[string][]string) MasterServer {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		page, ok := pages[testMasterSeed(req)]
+		if !ok {
+			return nil
+		}
+		return [][]byte{testMasterPage(page...)}
+	})
+	m := NewMasterServer()
+	m.SetAddr(r.Address())
+	return m
+}
+
+func TestMaster_Crawl(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015", "10.0.0.2:27015"},
+		"10.0.0.2:27015": {"10.0.0.2:27015", "10.0.0.3:27016"},
+		"10.0.0.3:27016": {"10.0.0.4:27015", Beggining},
+	})
+
+	result, err := m.Crawl(context.Background(), CrawlOptions{PageTimeout: time.Second})
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	if !result.Complete || result.Pages != 3 {
+		t.Log("Expected a complete crawl of 3 pages, got", result.Pages, result.Complete)
+		t.FailNow()
+	}
+
+	var got []string
+	for _, s := range result.Servers {
+		got = append(got, s.Address())
+	}
+	expected := "[10.0.0.1:27015 10.0.0.2:27015 10.0.0.3:27016 10.0.0.4:27015]"
+	if fmt.Sprint(got) != expected {
+		t.Log("Expected", expected, "got", got)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlMaxPages(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015"},
+		"10.0.0.1:27015": {"10.0.0.2:27015", Beggining},
+	})
+
+	result, err := m.Crawl(context.Background(), CrawlOptions{PageTimeout: time.Second, MaxPages: 1})
+	if err != nil || result.Complete || result.Pages != 1 || len(result.Servers) != 1 {
+		t.Log("Expected a single incomplete page, got", result, err)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlStalled(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015"},
+		"10.0.0.1:27015": {"10.0.0.1:27015"},
+	})
+
+	result, err := m.Crawl(context.Background(), CrawlOptions{PageTimeout: time.Second})
+	if !errors.Is(err, CrawlStalled) || result.Pages != 2 {
+		t.Log("Expected CrawlStalled after 2 pages, got", result.Pages, err)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlStream(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015", "10.0.0.2:27015"},
+		"10.0.0.2:27015": {"10.0.0.3:27015", Beggining},
+	})
+
+	var got []string
+	var pages []int
+	for item := range m.CrawlStream(context.Background(), CrawlOptions{PageTimeout: time.Second}) {
+		if item.Err != nil {
+			t.Log("Unexpected error:", item.Err)
+			t.FailNow()
+		}
+		got = append(got, item.Server.Address())
+		pages = append(pages, item.Page)
+	}
+
+	if fmt.Sprint(got, pages) != "[10.0.0.1:27015 10.0.0.2:27015 10.0.0.3:27015] [1 1 2]" {
+		t.Log("Unexpected stream:", got, pages)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlStreamCancel(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015", "10.0.0.2:27015"},
+		"10.0.0.2:27015": {"10.0.0.3:27015", Beggining},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	items := m.CrawlStream(ctx, CrawlOptions{PageTimeout: time.Second})
+	<-items
+	cancel()
+
+	// the channel must be closed promptly, not block on the
+	// items nobody is going to read any more
+	for range items {
+	}
+}
+
+func TestMaster_CrawlStreamReentrant(t *testing.T) {
+	m := newTestMaster(t, map[string][]string{
+		Beggining:        {"10.0.0.1:27015", "10.0.0.2:27015"},
+		"10.0.0.2:27015": {"10.0.0.3:27015", Beggining},
+	})
+
+	// using the master while reading its stream must not deadlock
+	opts := CrawlOptions{PageTimeout: time.Second}
+	for item := range m.CrawlStream(context.Background(), opts) {
+		if item.Err != nil {
+			t.Log("Unexpected error:", item.Err)
+			t.FailNow()
+		}
+		m.SetRegion(Europe)
+		m.GetAddr()
+		if _, err := m.Crawl(context.Background(), opts); err != nil {
+			t.Log("Unexpected error:", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMaster_CrawlRateLimited(t *testing.T) {
+	pages := map[string][]string{
+		Beggining:        {"10.0.0.1:27015"},
+		"10.0.0.1:27015": {"10.0.0.2:27015"},
+		"10.0.0.2:27015": {"10.0.0.3:27015", Beggining},
+	}
+	// after the first page, ignore every other request
+	requests := 0
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		requests++
+		if requests > 1 && requests%2 == 0 {
+			return nil
+		}
+		return [][]byte{testMasterPage(pages[testMasterSeed(req)]...)}
+	})
+	m := NewMasterServer()
+	m.SetAddr(r.Address())
+
+	result, err := m.Crawl(context.Background(), CrawlOptions{
+		PageTimeout: 50 * time.Millisecond,
+		Pacing: Pacing{
+			Interval:   time.Millisecond,
+			Backoff:    5 * time.Millisecond,
+			MaxBackoff: 20 * time.Millisecond,
+		},
+	})
+	if err != nil || !result.Complete || len(result.Servers) != 3 {
+		t.Log("Expected the crawl to ride out the rate limiting, got", result, err)
+		t.FailNow()
+	}
+	if result.Pacing.RateLimited != 2 || result.Pacing.Interval <= time.Millisecond {
+		t.Log("Expected the pacing to have slowed down, got", result.Pacing)
+		t.FailNow()
+	}
+	if m.GetAddr() != r.Address() {
+		t.Log("A rate limiting master should not be given up on.")
+		t.FailNow()
+	}
+}
+
+func TestMasterPool_failover(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+	good := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testMasterPage("10.0.0.1:27015", Beggining)}
+	})
+
+	pool := NewMasterPool(silent.Address(), good.Address())
+	m := NewMasterServerFromPool(pool)
+
+	opts := CrawlOptions{PageTimeout: 50 * time.Millisecond}
+	if _, err := m.Crawl(context.Background(), opts); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	health := pool.Health()
+	if health[0].Failures != 1 || health[1].Successes != 1 || health[1].Latency == 0 {
+		t.Log("Unexpected health:", health)
+		t.FailNow()
+	}
+
+	// a fresh MasterServer should go straight for the healthy master
+	if addr := NewMasterServerFromPool(pool).GetAddr(); addr != good.Address() {
+		t.Log("Expected the healthy master to be preferred, got", addr)
+		t.FailNow()
+	}
+
+	// and so should the next query of this one
+	if _, err := m.Crawl(context.Background(), opts); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if health := pool.Health(); health[0].Failures != 1 || health[1].Successes != 2 {
+		t.Log("Expected the second crawl to start at the healthy master, got", health)
+		t.FailNow()
+	}
+}
+
+func TestMasterPool_concurrent(t *testing.T) {
+	good := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testMasterPage("10.0.0.1:27015", Beggining)}
+	})
+	pool := NewMasterPool(good.Address())
+	shared := NewMasterServerFromPool(pool)
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := shared.Crawl(context.Background(), CrawlOptions{PageTimeout: time.Second})
+			done <- err
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Log("Unexpected error:", err)
+			t.FailNow()
+		}
+	}
+
+	if pool.Health()[0].Successes != 8 {
+		t.Log("Expected 8 successes, got", pool.Health()[0])
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlRegions(t *testing.T) {
+	listings := map[Region][]string{
+		USEast: {"10.0.0.1:27015", "10.0.0.2:27015", Beggining},
+		Europe: {"10.0.0.2:27015", "10.0.0.3:27015", Beggining},
+	}
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		listing, ok := listings[Region(req[1])]
+		if !ok {
+			return nil
+		}
+		return [][]byte{testMasterPage(listing...)}
+	})
+	m := NewMasterServerFromPool(NewMasterPool())
+	m.SetAddr(r.Address())
+
+	opts := CrawlOptions{PageTimeout: 50 * time.Millisecond}
+	result, err := m.CrawlRegions(context.Background(), []Region{USEast, Europe, Asia}, opts)
+
+	// Asia never answers
+	if err == nil || !errors.Is(err, Timeout) {
+		t.Log("Expected Asia to time out, got:", err)
+		t.FailNow()
+	}
+	if !result.Regions[USEast].Complete || !result.Regions[Europe].Complete || result.Regions[Asia].Complete {
+		t.Log("Unexpected region results:", result.Regions)
+		t.FailNow()
+	}
+
+	got := []string{}
+	for _, s := range result.Servers {
+		got = append(got, fmt.Sprint(s.Address(), s.Regions))
+	}
+	expected := "[10.0.0.1:27015[US East] 10.0.0.2:27015[US East Europe] 10.0.0.3:27015[Europe]]"
+	if fmt.Sprint(got) != expected {
+		t.Log("Expected", expected, "got", got)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlRegionsDuplicate(t *testing.T) {
+	var requests atomic.Int32
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		requests.Add(1)
+		return [][]byte{testMasterPage("10.0.0.1:27015", Beggining)}
+	})
+	m := NewMasterServerFromPool(NewMasterPool())
+	m.SetAddr(r.Address())
+
+	opts := CrawlOptions{PageTimeout: time.Second}
+	result, err := m.CrawlRegions(context.Background(), []Region{Europe, Europe}, opts)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if n := requests.Load(); n != 1 {
+		t.Log("Expected Europe to be crawled once, got", n, "requests.")
+		t.FailNow()
+	}
+	if len(result.Servers) != 1 || len(result.Servers[0].Regions) != 1 || len(result.Regions) != 1 {
+		t.Log("Unexpected result:", result.Servers, result.Regions)
+		t.FailNow()
+	}
+}
+
+func TestPacing_orDefault(t *testing.T) {
+	if p := (Pacing{}).orDefault(); p != DefaultPacing {
+		t.Log("Expected the zero Pacing to be DefaultPacing, got", p)
+		t.FailNow()
+	}
+	if p := NoPacing.orDefault(); p != (Pacing{}) {
+		t.Log("Expected NoPacing to turn everything off, got", p)
+		t.FailNow()
+	}
+
+	p := Pacing{Interval: -1, MaxRetries: -1, MaxInterval: -1}.orDefault()
+	want := DefaultPacing
+	want.Interval, want.MaxInterval, want.MaxRetries = 0, 0, 0
+	if p != want {
+		t.Log("Expected", want, "got", p)
+		t.FailNow()
+	}
+}
+
+func TestMaster_CrawlNoPacing(t *testing.T) {
+	pages := map[string][]string{
+		Beggining:        {"10.0.0.1:27015"},
+		"10.0.0.1:27015": {"10.0.0.2:27015", Beggining},
+	}
+	// answers the first page only
+	requests := 0
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		requests++
+		if requests > 1 {
+			return nil
+		}
+		return [][]byte{testMasterPage(pages[testMasterSeed(req)]...)}
+	})
+	// a pool of one, so that the crawl has nowhere to rotate to
+	m := NewMasterServerFromPool(NewMasterPool(r.Address()))
+
+	result, _ := m.Crawl(context.Background(), CrawlOptions{
+		PageTimeout: 50 * time.Millisecond,
+		Pacing:      NoPacing,
+	})
+	if result.Pacing.RateLimited != 0 || result.Pacing.Waited != 0 {
+		t.Log("Expected no backoff nor pacing, got", result.Pacing)
+		t.FailNow()
+	}
+}
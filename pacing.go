@@ -0,0 +1,157 @@
+package goseq
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Pacing controls how fast a crawl asks the masters for pages.
+//
+// Valve's masters don't answer clients that ask too quickly; they
+// just go quiet. A master that served earlier pages and then stops
+// answering is taken to be rate limiting us: the crawl waits out an
+// exponential backoff, retries the same master, and from then on
+// leaves more time between pages. A master that never answered is
+// assumed down and the crawl moves on to the healthiest master in
+// its MasterPool that it hasn't tried yet.
+//
+// Zero fields fall back to DefaultPacing. Negative ones turn off what
+// they control: a negative Interval or Backoff leaves no gap, a
+// negative MaxInterval or MaxBackoff keeps them from growing and a
+// negative MaxRetries moves on at the first silence. NoPacing turns
+// off everything.
+type Pacing struct {
+	// Interval is the least time between two page requests.
+	Interval time.Duration
+	// MaxInterval caps how far Interval grows under rate limiting.
+	MaxInterval time.Duration
+	// Backoff is the wait after the first silence. It doubles with
+	// every further silence on the same page, up to MaxBackoff, and
+	// gets up to half of itself added as jitter.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries is how many times a rate limiting master is
+	// retried for the same page before moving on to the next.
+	MaxRetries int
+}
+
+var (
+	DefaultPacing Pacing = Pacing{
+		Interval:    100 * time.Millisecond,
+		MaxInterval: 5 * time.Second,
+		Backoff:     time.Second,
+		MaxBackoff:  30 * time.Second,
+		MaxRetries:  5,
+	}
+	// NoPacing asks for pages as fast as the masters answer and
+	// gives up on a master at its first silence.
+	NoPacing Pacing = Pacing{
+		Interval:    -1,
+		MaxInterval: -1,
+		Backoff:     -1,
+		MaxBackoff:  -1,
+		MaxRetries:  -1,
+	}
+)
+
+// PacingReport describes the pacing a crawl ended up applying.
+type PacingReport struct {
+	// Interval is the gap between pages when the crawl ended.
+	Interval time.Duration
+	// RateLimited counts the silences taken for rate limiting.
+	RateLimited int
+	// Waited is the total time spent pacing and backing off.
+	Waited time.Duration
+}
+
+func (p Pacing) orDefault() Pacing {
+	if p.Interval == 0 {
+		p.Interval = DefaultPacing.Interval
+	}
+	if p.MaxInterval == 0 {
+		p.MaxInterval = DefaultPacing.MaxInterval
+	}
+	if p.Backoff == 0 {
+		p.Backoff = DefaultPacing.Backoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultPacing.MaxBackoff
+	}
+	if p.MaxRetries == 0 {
+		p.MaxRetries = DefaultPacing.MaxRetries
+	}
+
+	// what's left negative is turned off
+	p.Interval = max(p.Interval, 0)
+	p.Backoff = max(p.Backoff, 0)
+	p.MaxRetries = max(p.MaxRetries, 0)
+	if p.MaxInterval < 0 {
+		p.MaxInterval = p.Interval
+	}
+	if p.MaxBackoff < 0 {
+		p.MaxBackoff = p.Backoff
+	}
+	return p
+}
+
+// pacer applies a Pacing to a single crawl.
+type pacer struct {
+	Pacing
+	report PacingReport
+	last   time.Time
+	// the current master has served us a page
+	answered bool
+}
+
+func newPacer(p Pacing) *pacer {
+	pc := &pacer{Pacing: p.orDefault()}
+	pc.report.Interval = pc.Interval
+	return pc
+}
+
+// wait blocks until the next page may be requested.
+func (p *pacer) wait(ctx context.Context) error {
+	if !p.last.IsZero() {
+		if err := p.sleep(ctx, p.report.Interval-time.Since(p.last)); err != nil {
+			return err
+		}
+	}
+	p.last = time.Now()
+	return nil
+}
+
+// backoff blocks after the retry-th silence in a row, counting from 0,
+// and slows down the pages that follow.
+func (p *pacer) backoff(ctx context.Context, retry int) error {
+	p.report.RateLimited++
+	p.report.Interval = min(2*p.report.Interval, p.MaxInterval)
+
+	wait := p.Backoff
+	for i := 0; i < retry && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, p.MaxBackoff)
+	wait += time.Duration(rand.Int63n(int64(wait/2) + 1))
+
+	return p.sleep(ctx, wait)
+}
+
+func (p *pacer) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	start := time.Now()
+	defer func() { p.report.Waited += time.Since(start) }()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return contextErr(ctx, ctx.Err())
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"hash/crc32"
 	"io"
+	"net"
+	"sync"
 )
 
 const (
@@ -18,6 +20,9 @@ const (
 	// PayloadSize is the official packet-payload size
 	// of UDP headers.
 	PayloadSize int = 1400
+	// MaxDatagramSize is the largest payload a UDP
+	// datagram can carry over IPv4.
+	MaxDatagramSize int = 65507
 )
 
 var (
@@ -25,6 +30,8 @@ var (
 	PacketMalformed     error = errors.New("Packet appears malformed.")
 	PayloadSizeMismatch error = errors.New("Decompressed payload is not expected size.")
 	PayloadCRC32Fail    error = errors.New("CRC validation failed on decompressed payload. Possible corruption?")
+	PacketMissing       error = errors.New("A split packet never arrived; the response is incomplete.")
+	PacketTruncated     error = errors.New("Packet was larger than the maximum datagram size and got truncated.")
 )
 
 type pkt_header struct {
@@ -45,6 +52,33 @@ type pkt_header struct {
 	}
 }
 
+// splitLayout is the layout of the header that
+// follows the ID of a split packet.
+type splitLayout byte
+
+const (
+	// splitUnknown leaves the layout to be decided from
+	// the first packet of the response.
+	splitUnknown splitLayout = iota
+	// splitSource is Total, Number and Size, as sent by Source.
+	splitSource
+	// splitGoldSrc is a single byte with Number in the high
+	// nibble and Total in the low nibble, as sent by GoldSrc.
+	splitGoldSrc
+	// splitSourceNoSize is Total and Number, as sent by
+	// a few older Source games, see SplitOmitsSize.
+	splitSourceNoSize
+)
+
+// maxPendingSplits bounds how many split packets are held
+// back while the layout of a response is still unknown.
+const maxPendingSplits = 16
+
+// maxSplitGroups bounds how many split responses are reassembled
+// at once. Only one is ours; the others are strays from earlier
+// requests and get dropped oldest first.
+const maxSplitGroups = 4
+
 type packet struct {
 	Header  pkt_header
 	Payload []byte
@@ -64,25 +98,90 @@ func newPacket() packet {
 // and turns them into a single payload.
 // Strips all Source Packet specific headers.
 type packetStream struct {
-	expected int
+	packets []packet
+	layout  splitLayout
+	// largest datagram accepted, anything
+	// bigger is reported as PacketTruncated
+	maxSize int
+	limits  Limits
+	// the last datagram read, kept for error reports
+	last []byte
+	// split responses being reassembled, oldest first
+	groups []*splitGroup
+}
+
+// splitGroup collects the split packets sharing one ID.
+type splitGroup struct {
+	id       uint32
 	packets  []packet
+	have     []bool
+	received int
 }
 
 func newPacketStream() packetStream {
 	return packetStream{
-		expected: 1,
-		packets:  make([]packet, 1),
+		packets: make([]packet, 1),
+		maxSize: MaxDatagramSize,
+		limits:  DefaultLimits,
 	}
 }
 
+// newPacketStreamFor returns a stream that reads split headers
+// with the given layout instead of detecting it, accepts datagrams
+// of up to maxSize bytes and enforces limits.
+func newPacketStreamFor(layout splitLayout, maxSize int, limits Limits) packetStream {
+	st := newPacketStream()
+	st.layout = layout
+	st.maxSize = maxSize
+	st.limits = limits.orDefault()
+	return st
+}
+
 func pk_signals_compression(header *pkt_header) bool {
 	return (header.Extended.Std.ID & (1 << 31)) > 0
 }
 
+// Engine returns the engine whose split packets made up
+// the stream. Unsplit responses report SourceEngine.
+func (st *packetStream) Engine() Engine {
+	if st.layout == splitGoldSrc {
+		return GoldSrcEngine
+	}
+	return SourceEngine
+}
+
+func isSplitDatagram(full []byte) bool {
+	return len(full) >= 4 && byteOrder.Uint32(full) == pkt_SPLIT
+}
+
+// detectSplitLayout guesses the layout of a split packet by looking
+// for the simple header that starts the payload of the first packet
+// of every response. Packets that are not first can't be told apart
+// and are reported as splitUnknown.
+func detectSplitLayout(full []byte) splitLayout {
+	const goldSrcPayload, sourcePayload = 9, 12
+
+	if len(full) >= goldSrcPayload+packetHeaderSz &&
+		full[8]>>4 == 0 && full[8]&0x0F > 0 &&
+		bytes.HasPrefix(full[goldSrcPayload:], packetHeader[0:]) {
+		return splitGoldSrc
+	}
+
+	if len(full) >= sourcePayload && full[9] == 0 {
+		compressed := byteOrder.Uint32(full[4:])&(1<<31) > 0
+		if compressed || bytes.HasPrefix(full[sourcePayload:], packetHeader[0:]) {
+			return splitSource
+		}
+	}
+
+	return splitUnknown
+}
+
 // Take a byte buffer and assume it's a fuill UDP packet,
 // construct Source packet from it. AKA interpret source
 // headers and find where the payload starts.
-func contructPacket(full []byte) (packet, error) {
+// layout decides how split headers are read.
+func contructPacket(full []byte, layout splitLayout) (packet, error) {
 	pk := newPacket()
 	buf := bytes.NewBuffer(full)
 	var err error
@@ -104,7 +203,34 @@ func contructPacket(full []byte) (packet, error) {
 
 	// The packet is not assumed to be split.
 	// Read split headers.
-	if err = binary.Read(buf, byteOrder, &pk.Header.Extended.Std); err != nil {
+	if layout == splitGoldSrc {
+		var packed byte
+		if err = binary.Read(buf, byteOrder, &pk.Header.Extended.Std.ID); err != nil {
+			return pk, err
+		}
+		if packed, err = buf.ReadByte(); err != nil {
+			return pk, err
+		}
+		pk.Header.Extended.Std.Number = packed >> 4
+		pk.Header.Extended.Std.Total = packed & 0x0F
+		// GoldSrc never compresses.
+		pk.Payload = buf.Bytes()
+		return pk, nil
+	}
+
+	if layout == splitSourceNoSize {
+		var std struct {
+			ID     uint32
+			Total  byte
+			Number byte
+		}
+		if err = binary.Read(buf, byteOrder, &std); err != nil {
+			return pk, err
+		}
+		pk.Header.Extended.Std.ID = std.ID
+		pk.Header.Extended.Std.Total = std.Total
+		pk.Header.Extended.Std.Number = std.Number
+	} else if err = binary.Read(buf, byteOrder, &pk.Header.Extended.Std); err != nil {
 		return pk, err
 	}
 
@@ -125,39 +251,146 @@ func contructPacket(full []byte) (packet, error) {
 	return pk, nil
 }
 
-// Gobble packets from the connection.
-// Number of packets are determined by the format of
-// the packet.
-func (st *packetStream) Gobble(reader io.Reader) error {
-	for got := 0; got < st.expected; got++ {
-		var buffer [PayloadSize]byte
-		var n int
-		var err error
-		var pk packet
+// datagramBuffers are the read buffers of Gobble, large enough for
+// any datagram. Bulk queries and crawls read a great many responses;
+// allocating 64KB for each would keep the collector busy.
+var datagramBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, MaxDatagramSize+1)
+		return &buffer
+	},
+}
 
-		if n, err = reader.Read(buffer[0:]); err != nil {
+// Gobble packets from the connection until one complete
+// response has been read. Split packets are matched up by ID,
+// so they may arrive in any order; duplicates are ignored and
+// packets belonging to other responses are dropped.
+func (st *packetStream) Gobble(reader io.Reader) error {
+	// split packets that arrived before we
+	// could tell which engine sent them
+	var pending [][]byte
+
+	// One byte of slack: a datagram that fills it
+	// was cut short by the socket.
+	pooled := datagramBuffers.Get().(*[]byte)
+	defer datagramBuffers.Put(pooled)
+	buffer := (*pooled)[0 : min(st.maxSize, MaxDatagramSize)+1]
+
+	for {
+		n, err := reader.Read(buffer)
+		if err != nil {
+			if isDeadlineErr(err) && (len(st.groups) > 0 || len(pending) > 0) {
+				return PacketMissing
+			}
 			return err
 		}
+		if n > st.maxSize {
+			st.last = append([]byte(nil), buffer[0:n]...)
+			return PacketTruncated
+		}
+		full := append([]byte(nil), buffer[0:n]...)
+		st.last = full
+
+		if !isSplitDatagram(full) {
+			pk, err := contructPacket(full, st.layout)
+			if err != nil {
+				return err
+			}
+			st.packets = []packet{pk}
+			return nil
+		}
 
-		if pk, err = contructPacket(buffer[0:n]); err != nil {
-			return err
+		if st.layout == splitUnknown {
+			if st.layout = detectSplitLayout(full); st.layout == splitUnknown {
+				if len(pending) >= maxPendingSplits {
+					return PacketMalformed
+				}
+				pending = append(pending, full)
+				continue
+			}
+			for _, held := range pending {
+				if done, err := st.add(held); done || err != nil {
+					return err
+				}
+			}
+			pending = nil
 		}
 
-		// resize packet buffer to fit new expected total
-		if st.expected != int(pk.Header.Extended.Std.Total) {
-			st.expected = int(pk.Header.Extended.Std.Total)
-			st.packets = make([]packet, st.expected)
+		if done, err := st.add(full); done || err != nil {
+			return err
 		}
+	}
+}
+
+// add files a split packet under its response and
+// reports whether that response is now complete.
+func (st *packetStream) add(full []byte) (bool, error) {
+	pk, err := contructPacket(full, st.layout)
+	if err != nil {
+		return false, err
+	}
 
-		// noone like buffer overflows.
-		if int(pk.Header.Extended.Std.Number) >= len(st.packets) {
-			// a naughty server is trying to crash us.
-			return PacketMalformed
+	std := &pk.Header.Extended.Std
+	// noone like buffer overflows.
+	if std.Total == 0 || std.Number >= std.Total {
+		// a naughty server is trying to crash us.
+		return false, PacketMalformed
+	}
+
+	if err = checkLimit("MaxSplitPackets", st.limits.MaxSplitPackets, int(std.Total)); err != nil {
+		return false, err
+	}
+
+	g := st.group(std.ID, int(std.Total))
+	if len(g.packets) != int(std.Total) {
+		return false, PacketMalformed
+	}
+
+	if g.have[std.Number] {
+		// duplicate
+		return false, nil
+	}
+	g.packets[std.Number] = pk
+	g.have[std.Number] = true
+	g.received++
+
+	if g.received < len(g.packets) {
+		return false, nil
+	}
+
+	st.packets = g.packets
+	st.groups = nil
+	return true, nil
+}
+
+// group returns the response with the given ID,
+// starting a new one if it hasn't been seen yet.
+func (st *packetStream) group(id uint32, total int) *splitGroup {
+	for _, g := range st.groups {
+		if g.id == id {
+			return g
 		}
+	}
 
-		st.packets[pk.Header.Extended.Std.Number] = pk
+	g := &splitGroup{
+		id:      id,
+		packets: make([]packet, total),
+		have:    make([]bool, total),
+	}
+	st.groups = append(st.groups, g)
+	if len(st.groups) > maxSplitGroups {
+		st.groups = st.groups[1:]
 	}
-	return nil
+	return g
+}
+
+// isDeadlineErr reports whether err came from a socket whose
+// deadline expired or that was closed under our feet.
+func isDeadlineErr(err error) bool {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, net.ErrClosed)
 }
 
 // Returns the conitguous payload, decompressing if necessary.
@@ -169,18 +402,30 @@ func (st *packetStream) GetFullPayload() ([]byte, error) {
 
 	if !pk_signals_compression(pkh) {
 		// no need to decompress, just return the payload
-		return payload, nil
+		return st.stripSimpleHeader(payload), nil
+	}
+
+	// The claimed size comes straight from the wire;
+	// check it before trusting it with an allocation.
+	maxSize := st.limits.MaxDecompressedSize
+	if err := checkLimit("MaxDecompressedSize", maxSize, int(pkh.Extended.ComprInf.Size)); err != nil {
+		return nil, err
 	}
 
 	// Decompressed buffer
 	decompressed := bytes.NewBuffer(make([]byte, 0, pkh.Extended.ComprInf.Size))
-	// Decompress data
-	copied, err := io.Copy(decompressed, bzip2.NewReader(bytes.NewBuffer(payload)))
+	// Decompress data, but never more than we allow
+	inflater := io.LimitReader(bzip2.NewReader(bytes.NewBuffer(payload)), int64(maxSize)+1)
+	copied, err := io.Copy(decompressed, inflater)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if err = checkLimit("MaxDecompressedSize", maxSize, int(copied)); err != nil {
+		return nil, err
+	}
+
 	if copied != int64(pkh.Extended.ComprInf.Size) {
 		return nil, PayloadSizeMismatch
 	}
@@ -195,7 +440,20 @@ func (st *packetStream) GetFullPayload() ([]byte, error) {
 		return nil, PayloadCRC32Fail
 	}
 
-	return decompressed_buf, nil
+	return st.stripSimpleHeader(decompressed_buf), nil
+}
+
+// A split response carries the whole original packet, simple
+// header included. Strip it so callers see the same payload
+// whether or not the response was split.
+func (st *packetStream) stripSimpleHeader(payload []byte) []byte {
+	if st.packets[0].Header.Std.HeaderCode != pkt_SPLIT {
+		return payload
+	}
+	if bytes.HasPrefix(payload, packetHeader[0:]) {
+		return payload[packetHeaderSz:]
+	}
+	return payload
 }
 
 func (st *packetStream) contiguous_payload() []byte {
@@ -0,0 +1,370 @@
+package goseq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// datagramReader hands out one datagram per Read,
+// like a UDP socket would. Once it runs dry it fails
+// as if the socket's deadline had expired.
+type datagramReader struct {
+	datagrams [][]byte
+}
+
+func (r *datagramReader) Read(b []byte) (int, error) {
+	if len(r.datagrams) == 0 {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(b, r.datagrams[0])
+	r.datagrams = r.datagrams[1:]
+	return n, nil
+}
+
+// testSplitSource splits payload into Source split packets
+// carrying at most size bytes each.
+func testSplitSource(id uint32, payload []byte, size int) [][]byte {
+	total := (len(payload) + size - 1) / size
+	var datagrams [][]byte
+	for i := 0; i < total; i++ {
+		chunk := payload[i*size : min((i+1)*size, len(payload))]
+		buf := bytes.NewBuffer(nil)
+		binary.Write(buf, byteOrder, pkt_SPLIT)
+		binary.Write(buf, byteOrder, id)
+		buf.WriteByte(byte(total))
+		buf.WriteByte(byte(i))
+		binary.Write(buf, byteOrder, int16(size))
+		buf.Write(chunk)
+		datagrams = append(datagrams, buf.Bytes())
+	}
+	return datagrams
+}
+
+// testSplitGoldSrc splits payload into GoldSrc split packets
+// carrying at most size bytes each.
+func testSplitGoldSrc(id uint32, payload []byte, size int) [][]byte {
+	total := (len(payload) + size - 1) / size
+	var datagrams [][]byte
+	for i := 0; i < total; i++ {
+		chunk := payload[i*size : min((i+1)*size, len(payload))]
+		buf := bytes.NewBuffer(nil)
+		binary.Write(buf, byteOrder, pkt_SPLIT)
+		binary.Write(buf, byteOrder, id)
+		buf.WriteByte(byte(i<<4 | total))
+		buf.Write(chunk)
+		datagrams = append(datagrams, buf.Bytes())
+	}
+	return datagrams
+}
+
+func testGobble(t *testing.T, datagrams [][]byte) (*packetStream, []byte) {
+	st := newPacketStream()
+	if err := st.Gobble(&datagramReader{datagrams: datagrams}); err != nil {
+		t.Log("Unexpected Gobble error:", err)
+		t.FailNow()
+	}
+	payload, err := st.GetFullPayload()
+	if err != nil {
+		t.Log("Unexpected payload error:", err)
+		t.FailNow()
+	}
+	return &st, payload
+}
+
+func TestPacketStream_source(t *testing.T) {
+	whole := testRulesResponse()
+	st, payload := testGobble(t, testSplitSource(7, whole, 10))
+
+	if !bytes.Equal(payload, whole[packetHeaderSz:]) {
+		t.Log("Reassembled payload differs:", payload)
+		t.FailNow()
+	}
+	if st.Engine() != SourceEngine {
+		t.Log("Expected Source split layout, got", st.Engine())
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_goldSrc(t *testing.T) {
+	whole := testRulesResponse()
+	st, payload := testGobble(t, testSplitGoldSrc(7, whole, 10))
+
+	if !bytes.Equal(payload, whole[packetHeaderSz:]) {
+		t.Log("Reassembled payload differs:", payload)
+		t.FailNow()
+	}
+	if st.Engine() != GoldSrcEngine {
+		t.Log("Expected GoldSrc split layout, got", st.Engine())
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_goldSrcReordered(t *testing.T) {
+	whole := testRulesResponse()
+	datagrams := testSplitGoldSrc(7, whole, 10)
+	// first packet arrives last; the others must be held back
+	datagrams = append(datagrams[1:], datagrams[0])
+
+	_, payload := testGobble(t, datagrams)
+	if !bytes.Equal(payload, whole[packetHeaderSz:]) {
+		t.Log("Reassembled payload differs:", payload)
+		t.FailNow()
+	}
+}
+
+func TestServerInfo_decodeGoldSrc(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(tGoldSrcInfoRespID)
+	buf.WriteString("127.0.0.1:27015\x00")
+	buf.WriteString("goldsrc server\x00")
+	buf.WriteString("de_inferno\x00")
+	buf.WriteString("cstrike\x00")
+	buf.WriteString("Counter-Strike\x00")
+	buf.Write([]byte{5, 32, 47, 'D', 'L', 0, 1})
+	buf.WriteString("http://example.org\x00")
+	buf.WriteString("\x00")
+	buf.WriteByte(0)
+	binary.Write(buf, byteOrder, int32(1))
+	binary.Write(buf, byteOrder, int32(184000000))
+	buf.Write([]byte{1, 1})
+	buf.Write([]byte{1, 3}) // VAC, bots
+
+	info := NewServerInfo()
+	if err := info.decode(buf); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	if info.GetEngine() != GoldSrcEngine || info.GetAddress() != "127.0.0.1:27015" {
+		t.Log("GoldSrc header decoded incorrectly:", info.GetEngine(), info.GetAddress())
+		t.FailNow()
+	}
+	if info.GetMap() != "de_inferno" || info.GetMaxPlayers() != 32 || info.GetEnvironment() != Linux {
+		t.Log("GoldSrc fields decoded incorrectly:", info.GetMap(), info.GetMaxPlayers(), info.GetEnvironment())
+		t.FailNow()
+	}
+	if !info.IsMod() || info.GetModLink() != "http://example.org" || info.GetModSize() != 184000000 {
+		t.Log("GoldSrc mod info decoded incorrectly:", info.GetModLink(), info.GetModSize())
+		t.FailNow()
+	}
+	if info.GetVAC() != 1 || info.GetBots() != 3 {
+		t.Log("GoldSrc trailer decoded incorrectly:", info.GetVAC(), info.GetBots())
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_shuffledDuplicatesAndStrays(t *testing.T) {
+	whole := testRulesResponse()
+	ours := testSplitSource(7, whole, 8)
+	stray := testSplitSource(6, testPlayersResponse(), 8)
+
+	datagrams := [][]byte{
+		stray[0],
+		ours[3], ours[1],
+		stray[1],
+		ours[1], // duplicate
+		ours[0], ours[2],
+	}
+	datagrams = append(datagrams, ours[4:]...)
+
+	_, payload := testGobble(t, datagrams)
+	if !bytes.Equal(payload, whole[packetHeaderSz:]) {
+		t.Log("Reassembled payload differs:", payload)
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_missing(t *testing.T) {
+	datagrams := testSplitSource(7, testRulesResponse(), 8)
+	// drop a packet from the middle
+	datagrams = append(datagrams[:2], datagrams[3:]...)
+
+	st := newPacketStream()
+	if err := st.Gobble(&datagramReader{datagrams: datagrams}); err != PacketMissing {
+		t.Log("Expected PacketMissing, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_inconsistentTotal(t *testing.T) {
+	a := testSplitSource(7, testRulesResponse(), 8)
+	b := testSplitSource(7, testRulesResponse(), 16)
+
+	st := newPacketStream()
+	err := st.Gobble(&datagramReader{datagrams: [][]byte{a[0], b[1]}})
+	if err != PacketMalformed {
+		t.Log("Expected PacketMalformed, got:", err)
+		t.FailNow()
+	}
+}
+
+// testSplitNoSize splits payload like testSplitSource,
+// but leaves out the Size field.
+func testSplitNoSize(id uint32, payload []byte, size int) [][]byte {
+	datagrams := testSplitSource(id, payload, size)
+	for i, d := range datagrams {
+		datagrams[i] = append(d[:10:10], d[12:]...)
+	}
+	return datagrams
+}
+
+func TestSplitQuirk_learnedFromInfo(t *testing.T) {
+	RegisterSplitQuirk(730, 17, SplitOmitsSize)
+	defer RegisterSplitQuirk(730, 17, NoSplitQuirk)
+
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		switch req[4] {
+		case tInfoPacketReqID:
+			return [][]byte{testInfoResponse()}
+		case tRulesPacketReqID:
+			return testSplitNoSize(3, testRulesResponse(), 10)
+		}
+		return nil
+	})
+	s := r.Server()
+
+	if _, err := s.Info(time.Second); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	rules, err := s.Rules(time.Second)
+	if err != nil || rules["mp_friendlyfire"] != "1" {
+		t.Log("Quirk not applied:", rules, err)
+		t.FailNow()
+	}
+}
+
+func TestSplitQuirk_lookup(t *testing.T) {
+	if LookupSplitQuirk(240, 7) != SplitOmitsSize {
+		t.Log("Expected old Counter-Strike: Source builds to omit Size.")
+		t.FailNow()
+	}
+	if LookupSplitQuirk(240, 17) != NoSplitQuirk {
+		t.Log("Current Counter-Strike: Source builds should not be quirked.")
+		t.FailNow()
+	}
+	if LookupSplitQuirk(215, 24) != SplitOmitsSize {
+		t.Log("AnyProtocol entries should match every protocol.")
+		t.FailNow()
+	}
+}
+
+func TestPacketStream_truncated(t *testing.T) {
+	st := newPacketStreamFor(splitUnknown, 16, Limits{})
+	err := st.Gobble(&datagramReader{datagrams: [][]byte{testRulesResponse()}})
+	if err != PacketTruncated {
+		t.Log("Expected PacketTruncated, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestServer_datagramSizeGrows(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testRulesResponse()}
+	})
+	s := r.Server()
+	s.SetMaxDatagramSize(len(testRulesResponse()) - 1)
+
+	if _, err := s.Rules(time.Second); !errors.Is(err, PacketTruncated) {
+		t.Log("Expected PacketTruncated, got:", err)
+		t.FailNow()
+	}
+	if _, err := s.Rules(time.Second); err != nil {
+		t.Log("Expected the datagram size to have grown, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestLimits_splitPackets(t *testing.T) {
+	datagrams := testSplitSource(7, testRulesResponse(), 4)
+
+	st := newPacketStreamFor(splitUnknown, MaxDatagramSize, Limits{MaxSplitPackets: 4})
+	err := st.Gobble(&datagramReader{datagrams: datagrams})
+	if lerr, ok := err.(*LimitError); !ok || lerr.Limit != "MaxSplitPackets" || !errors.Is(err, LimitExceeded) {
+		t.Log("Expected a MaxSplitPackets LimitError, got:", err)
+		t.FailNow()
+	}
+}
+
+// testBzipBomb is a compressed split packet
+// that claims to inflate to 3GB.
+func testBzipBomb() []byte {
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, byteOrder, pkt_SPLIT)
+	binary.Write(buf, byteOrder, uint32(1<<31|7))
+	buf.Write([]byte{1, 0})
+	binary.Write(buf, byteOrder, int16(1248))
+	binary.Write(buf, byteOrder, uint32(3<<30))
+	binary.Write(buf, byteOrder, uint32(0))
+	buf.WriteString("BZh91AY&SY")
+	return buf.Bytes()
+}
+
+func TestLimits_decompressedSize(t *testing.T) {
+	st := newPacketStream()
+	if err := st.Gobble(&datagramReader{datagrams: [][]byte{testBzipBomb()}}); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if _, err := st.GetFullPayload(); !errors.Is(err, LimitExceeded) {
+		t.Log("Expected LimitExceeded, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestLimits_decompressedSizeStage(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testBzipBomb()}
+	})
+
+	_, err := r.Server().Rules(time.Second)
+	var qerr *QueryError
+	if !errors.As(err, &qerr) || !errors.Is(err, LimitExceeded) {
+		t.Log("Expected a LimitExceeded QueryError, got:", err)
+		t.FailNow()
+	}
+	if qerr.Stage != StageDecode {
+		t.Log("Expected StageDecode, got:", qerr.Stage)
+		t.FailNow()
+	}
+}
+
+func TestLimits_players(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		return [][]byte{testPlayersResponse()}
+	})
+	s := r.Server()
+	s.SetLimits(Limits{MaxPlayers: 1})
+
+	if _, err := s.Players(time.Second); !errors.Is(err, LimitExceeded) {
+		t.Log("Expected LimitExceeded, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestGobble_reusesBuffer(t *testing.T) {
+	datagram := append(packetHeader[0:], "Ihello\x00"...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 100; i++ {
+		st := newPacketStream()
+		if err := st.Gobble(&datagramReader{datagrams: [][]byte{datagram}}); err != nil {
+			t.Log("Unexpected Gobble error:", err)
+			t.FailNow()
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	// well below a buffer per read
+	if perRead := (after.TotalAlloc - before.TotalAlloc) / 100; perRead > uint64(MaxDatagramSize)/2 {
+		t.Log("Gobble allocated", perRead, "bytes per read.")
+		t.FailNow()
+	}
+}
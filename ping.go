@@ -1,6 +1,7 @@
 package goseq
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -10,37 +11,33 @@ var (
 	Timeout error = errors.New("The server did not respond in time (timeout).")
 )
 
-func (s *iserver) Ping(timeout time.Duration) (time.Duration, error) {
+func (s *iserver) PingContext(ctx context.Context) (took time.Duration, err error) {
+	err = s.retry(ctx, func(ctx context.Context) error {
+		took, err = s.ping(ctx)
+		return err
+	})
+	return took, queryErr(s.Address(), PingRequest, err)
+}
+
+func (s *iserver) ping(ctx context.Context) (time.Duration, error) {
 	conn, err := s.getConnection()
 	if err != nil {
 		return 0, err
 	}
+	defer conn.Close()
+	defer bindContext(ctx, conn)()
 
-	timer := make(chan bool)
-	done := make(chan time.Duration)
-
-	request := append(packetHeader[0:], 0x69)
+	request := append(packetHeader[0:], byte(PingRequest))
 	response := make([]byte, binary.Size(pingPacket{}))
-	n := 0
 
-	go func() {
-		time.Sleep(timeout)
-		timer <- true
-	}()
-	go func() {
-
-		conn.Write(request[0:])
-		start := time.Now()
-		n, err = conn.Read(response[0:])
-		done <- time.Now().Sub(start)
-	}()
-
-	select {
-	case <-timer:
-		return 0, Timeout
-	case took := <-done:
-		return took, err
+	if _, err = conn.Write(request); err != nil {
+		return 0, stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+	start := time.Now()
+	if _, err = conn.Read(response); err != nil {
+		return 0, stageErr(StageRead, nil, contextErr(ctx, err))
 	}
+	return time.Since(start), nil
 }
 
 type pingPacket struct {
@@ -2,6 +2,7 @@ package goseq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -54,46 +55,42 @@ func (p packetPtPlayer) Duration() time.Duration {
 	return time.Duration(flrep)
 }
 
-func (serv *iserver) Players(limit time.Duration) (players []Player, err error) {
-	timer := time.NewTimer(limit)
-	done := make(chan bool)
-
-	go func() { players, err = serv.get_players(); done <- true }()
-
-	select {
-	case <-timer.C:
-		return nil, Timeout
-	case <-done:
-		return
+func (serv *iserver) PlayersContext(ctx context.Context) (players []Player, err error) {
+	err = serv.retry(ctx, func(ctx context.Context) error {
+		players, err = serv.get_players(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, queryErr(serv.Address(), PlayersRequest, err)
 	}
+	return players, nil
 }
 
-func (serv *iserver) get_players() (players []Player, err error) {
-	var challengeId int32
-	if challengeId, err = serv.getChallenge(tPlayersPacketReqID); err != nil {
-		return
-	}
+func newPlayersRequestBA(chalValue int32) []byte {
+	return newWrappedChallengeBA(tPlayersPacketReqID, chalValue)
+}
 
+func (serv *iserver) get_players(ctx context.Context) (players []Player, err error) {
 	conn, err := serv.getConnection()
 	if err != nil {
 		return
 	}
+	defer conn.Close()
+	defer bindContext(ctx, conn)()
 
-	request := newWrappedChallengeBA(tPlayersPacketReqID, challengeId)
-	if _, err = conn.Write(request); err != nil {
-		return
-	}
-
-	stream := newPacketStream()
-	if err = stream.Gobble(conn); err != nil {
+	payload, path, err := serv.handshake(ctx, conn, newPlayersRequestBA, []byte{tPlayersPacketRespID}, true)
+	if err != nil {
 		return
 	}
+	reportFor(ctx).Handshake = path
 
-	payload, err := stream.GetFullPayload()
-	if err != nil {
-		return
+	if players, err = decodePlayers(payload, serv.limits.orDefault()); err != nil {
+		err = stageErr(StageDecode, payload, err)
 	}
+	return
+}
 
+func decodePlayers(payload []byte, limits Limits) (players []Player, err error) {
 	buf := bytes.NewBuffer(payload)
 
 	resp := wrPlayerResponse{}
@@ -106,11 +103,19 @@ func (serv *iserver) get_players() (players []Player, err error) {
 		return
 	}
 
+	if err = checkLimit("MaxPlayers", limits.MaxPlayers, int(resp.NumPlayers)); err != nil {
+		return
+	}
+
 	if buf.Len() < minPlayerSize*int(resp.NumPlayers) {
 		err = MissingPlayers
 		return
 	}
 
+	// not nil, even for an empty server: nil
+	// stands for players that weren't queried
+	players = make([]Player, 0, resp.NumPlayers)
+
 	for i := uint8(0); i < resp.NumPlayers; i++ {
 		plr := packetPtPlayer{}
 		// Index
@@ -0,0 +1,162 @@
+package goseq
+
+import (
+	"sync"
+	"time"
+)
+
+// masterHistory is how many outcomes an endpoint remembers before
+// older ones start to fade, so that a master that was down can win
+// its place back.
+const masterHistory = 100
+
+// MasterPool is a set of master servers and how well each of them
+// has been answering. MasterServers sharing a pool steer each other
+// away from masters that are down or slow. A MasterPool is safe for
+// concurrent use.
+type MasterPool struct {
+	mu        sync.Mutex
+	endpoints []*masterEndpoint
+}
+
+type masterEndpoint struct {
+	addr      string
+	successes int
+	failures  int
+	// moving average, 0 until the first answer
+	latency time.Duration
+}
+
+// MasterHealth is a snapshot of how a master has been answering.
+type MasterHealth struct {
+	Addr      string
+	Successes int
+	Failures  int
+	// Latency is a moving average of the time taken to answer.
+	Latency time.Duration
+}
+
+// SuccessRate is the share of requests the master answered,
+// starting from an even chance before any were made.
+func (h MasterHealth) SuccessRate() float64 {
+	return float64(h.Successes+1) / float64(h.Successes+h.Failures+2)
+}
+
+// NewMasterPool returns a pool of the given masters. They are
+// preferred in the order given until their health sets them apart.
+func NewMasterPool(addrs ...string) *MasterPool {
+	p := &MasterPool{}
+	for _, addr := range addrs {
+		p.endpoints = append(p.endpoints, &masterEndpoint{addr: addr})
+	}
+	return p
+}
+
+var (
+	defaultPool     *MasterPool
+	defaultPoolOnce sync.Once
+)
+
+// DefaultMasterPool is the pool used by NewMasterServer. It is
+// made from MasterSourceServers the first time it is needed.
+func DefaultMasterPool() *MasterPool {
+	defaultPoolOnce.Do(func() {
+		defaultPool = NewMasterPool(MasterSourceServers...)
+	})
+	return defaultPool
+}
+
+// Health returns a snapshot of every master in the pool.
+func (p *MasterPool) Health() []MasterHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]MasterHealth, len(p.endpoints))
+	for i, e := range p.endpoints {
+		health[i] = e.health()
+	}
+	return health
+}
+
+// Best returns the healthiest master, or "" for an empty pool.
+func (p *MasterPool) Best() string {
+	return p.best(nil)
+}
+
+// best returns the healthiest master not in exclude,
+// or "" if there is none left.
+func (p *MasterPool) best(exclude map[string]bool) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *masterEndpoint
+	for _, e := range p.endpoints {
+		if exclude[e.addr] {
+			continue
+		}
+		if best == nil || e.healthier(best) {
+			best = e
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.addr
+}
+
+// report records the outcome of a request to addr. Masters that
+// are not part of the pool are ignored.
+func (p *MasterPool) report(addr string, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.endpoints {
+		if e.addr != addr {
+			continue
+		}
+
+		if e.successes+e.failures >= masterHistory {
+			e.successes /= 2
+			e.failures /= 2
+		}
+
+		if err != nil {
+			e.failures++
+			return
+		}
+
+		e.successes++
+		if e.latency == 0 {
+			e.latency = latency
+		} else {
+			e.latency = (7*e.latency + latency) / 8
+		}
+		return
+	}
+}
+
+func (e *masterEndpoint) health() MasterHealth {
+	return MasterHealth{
+		Addr:      e.addr,
+		Successes: e.successes,
+		Failures:  e.failures,
+		Latency:   e.latency,
+	}
+}
+
+func (e *masterEndpoint) healthier(than *masterEndpoint) bool {
+	a, b := e.health(), than.health()
+	if a.SuccessRate() != b.SuccessRate() {
+		return a.SuccessRate() > b.SuccessRate()
+	}
+	return e.expectedLatency() < than.expectedLatency()
+}
+
+// expectedLatency assumes the worst of masters
+// we haven't heard from yet.
+func (e *masterEndpoint) expectedLatency() time.Duration {
+	if e.latency == 0 {
+		return MasterServerTimeout
+	}
+	return e.latency
+}
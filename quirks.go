@@ -0,0 +1,80 @@
+package goseq
+
+import (
+	"sync"
+)
+
+// SplitQuirk is a deviation from the standard Source
+// split packet header that some games still send.
+type SplitQuirk byte
+
+const (
+	// NoSplitQuirk leaves the layout to be detected
+	// from the response itself.
+	NoSplitQuirk SplitQuirk = iota
+	// SplitOmitsSize means the 2-byte Size field that
+	// follows Number is missing.
+	SplitOmitsSize
+	// SplitGoldSrc means the GoldSrc header, with Number
+	// and Total packed into a single byte.
+	SplitGoldSrc
+)
+
+// AnyProtocol registers a quirk for every
+// protocol version of a game.
+const AnyProtocol byte = 0
+
+type quirkKey struct {
+	appID    int16
+	protocol byte
+}
+
+var (
+	splitQuirksLock sync.RWMutex
+	// Documented on the Valve developer wiki
+	// under "Server queries".
+	splitQuirks = map[quirkKey]SplitQuirk{
+		{215, AnyProtocol}:   SplitOmitsSize, // Source SDK Base 2006
+		{17550, AnyProtocol}: SplitOmitsSize, // Eternal Silence
+		{17700, AnyProtocol}: SplitOmitsSize, // Insurgency: Modern Infantry Combat
+		{240, 7}:             SplitOmitsSize, // Counter-Strike: Source, old builds
+	}
+)
+
+// RegisterSplitQuirk records that servers running appID send split
+// packets with the given quirk. Pass AnyProtocol unless the quirk
+// only affects one protocol version, as reported by ServerInfo.
+// Registering NoSplitQuirk removes an entry.
+func RegisterSplitQuirk(appID int16, protocol byte, quirk SplitQuirk) {
+	splitQuirksLock.Lock()
+	defer splitQuirksLock.Unlock()
+
+	key := quirkKey{appID, protocol}
+	if quirk == NoSplitQuirk {
+		delete(splitQuirks, key)
+		return
+	}
+	splitQuirks[key] = quirk
+}
+
+// LookupSplitQuirk returns the quirk registered for appID,
+// preferring an entry for the exact protocol version.
+func LookupSplitQuirk(appID int16, protocol byte) SplitQuirk {
+	splitQuirksLock.RLock()
+	defer splitQuirksLock.RUnlock()
+
+	if quirk, ok := splitQuirks[quirkKey{appID, protocol}]; ok {
+		return quirk
+	}
+	return splitQuirks[quirkKey{appID, AnyProtocol}]
+}
+
+func (q SplitQuirk) layout() splitLayout {
+	switch q {
+	case SplitOmitsSize:
+		return splitSourceNoSize
+	case SplitGoldSrc:
+		return splitGoldSrc
+	}
+	return splitUnknown
+}
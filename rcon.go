@@ -0,0 +1,231 @@
+package goseq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rconAuth          int32 = 3 // SERVERDATA_AUTH
+	rconAuthResponse  int32 = 2 // SERVERDATA_AUTH_RESPONSE
+	rconExecCommand   int32 = 2 // SERVERDATA_EXECCOMMAND
+	rconResponseValue int32 = 0 // SERVERDATA_RESPONSE_VALUE
+
+	// id, type and the two NULs ending the body
+	rconPacketOverhead int = 10
+	// Valve caps packets at 4096 bytes; leave room
+	// for servers that don't.
+	maxRCONPacketSize int = 1 << 16
+)
+
+var (
+	RCONAuthFailed error = errors.New("The server rejected the RCON password.")
+)
+
+// RCON runs console commands on a server.
+// Commands fail with a *QueryError.
+type RCON interface {
+	Address() string
+	// Exec runs command and returns what it printed.
+	Exec(command string, timeout time.Duration) (string, error)
+	ExecContext(ctx context.Context, command string) (string, error)
+	// SetLimits caps how much output a command may return.
+	SetLimits(Limits)
+	Close() error
+}
+
+// sourceRCON speaks the Source RCON protocol over TCP.
+// Commands take turns on the connection.
+type sourceRCON struct {
+	mu     sync.Mutex
+	addr   string
+	conn   net.Conn
+	reader *bufio.Reader
+	lastID int32
+	limits Limits
+	broken bool
+}
+
+// DialRCON logs in to the Source RCON of the server at address,
+// which is the same host and port the server answers queries on.
+// See DialRCONContext.
+func DialRCON(address, password string, timeout time.Duration) (RCON, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return DialRCONContext(ctx, address, password)
+}
+
+// DialRCONContext logs in to the Source RCON of the server at
+// address. A wrong password fails with RCONAuthFailed.
+//
+// A command that fails, for instance because its context ran out,
+// leaves the connection closed, as the rest of its output would
+// garble that of the next one; later commands fail with
+// net.ErrClosed.
+func DialRCONContext(ctx context.Context, address, password string) (RCON, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, queryErr(address, RCONRequest, stageErr(StageConnect, nil, contextErr(ctx, err)))
+	}
+
+	r := &sourceRCON{addr: address, conn: conn, reader: bufio.NewReader(conn)}
+	if err := r.auth(ctx, password); err != nil {
+		conn.Close()
+		return nil, queryErr(address, RCONRequest, err)
+	}
+	return r, nil
+}
+
+func (r *sourceRCON) Address() string    { return r.addr }
+func (r *sourceRCON) SetLimits(l Limits) { r.mu.Lock(); r.limits = l; r.mu.Unlock() }
+func (r *sourceRCON) Close() error       { return r.conn.Close() }
+func (r *sourceRCON) nextID() int32      { r.lastID++; return r.lastID }
+
+// bind ties the connection to ctx for one exchange.
+func (r *sourceRCON) bind(ctx context.Context) func() {
+	release := bindContext(ctx, r.conn)
+	return func() {
+		release()
+		r.conn.SetDeadline(time.Time{})
+	}
+}
+
+func (r *sourceRCON) auth(ctx context.Context, password string) error {
+	defer r.bind(ctx)()
+
+	id := r.nextID()
+	if err := r.write(id, rconAuth, password); err != nil {
+		return stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+
+	// An empty RESPONSE_VALUE comes first, then the verdict.
+	for {
+		pid, ptype, body, err := r.read()
+		if err != nil {
+			return stageErr(StageAuth, body, contextErr(ctx, err))
+		}
+		if ptype != rconAuthResponse {
+			continue
+		}
+		switch pid {
+		case id:
+			return nil
+		case -1:
+			return stageErr(StageAuth, nil, RCONAuthFailed)
+		}
+	}
+}
+
+func (r *sourceRCON) Exec(command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.ExecContext(ctx, command)
+}
+
+func (r *sourceRCON) ExecContext(ctx context.Context, command string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.broken {
+		return "", queryErr(r.addr, RCONRequest, net.ErrClosed)
+	}
+
+	out, err := r.exec(ctx, command)
+	if err != nil {
+		// whatever is left of the output would be
+		// taken for that of the next command
+		r.broken = true
+		r.conn.Close()
+		return "", queryErr(r.addr, RCONRequest, err)
+	}
+	return out, nil
+}
+
+// exec sends command followed by an empty RESPONSE_VALUE. The server
+// answers packets in order and mirrors the empty one, so its echo
+// marks the end of the command's output however many packets that
+// took.
+func (r *sourceRCON) exec(ctx context.Context, command string) (string, error) {
+	defer r.bind(ctx)()
+
+	id, end := r.nextID(), r.nextID()
+	if err := r.write(id, rconExecCommand, command); err != nil {
+		return "", stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+	if err := r.write(end, rconResponseValue, ""); err != nil {
+		return "", stageErr(StageWrite, nil, contextErr(ctx, err))
+	}
+
+	limits := r.limits.orDefault()
+	var out strings.Builder
+	for {
+		pid, ptype, body, err := r.read()
+		if err != nil {
+			return "", stageErr(StageRead, body, contextErr(ctx, err))
+		}
+		if ptype != rconResponseValue {
+			continue
+		}
+		switch pid {
+		case id:
+			if err := checkLimit("MaxRCONResponse", limits.MaxRCONResponse, out.Len()+len(body)); err != nil {
+				return "", stageErr(StageRead, nil, err)
+			}
+			out.Write(body)
+		case end:
+			// srcds follows the echo with a packet holding
+			// 0x00000100, which the next command skips
+			// as its id is not one of its own.
+			return out.String(), nil
+		}
+	}
+}
+
+func (r *sourceRCON) write(id, ptype int32, body string) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 4+rconPacketOverhead+len(body)))
+	binary.Write(buf, byteOrder, int32(rconPacketOverhead+len(body)))
+	binary.Write(buf, byteOrder, id)
+	binary.Write(buf, byteOrder, ptype)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	_, err := r.conn.Write(buf.Bytes())
+	return err
+}
+
+// read returns the next packet. The body is returned
+// along with the error when the packet is malformed.
+func (r *sourceRCON) read() (id, ptype int32, body []byte, err error) {
+	var size int32
+	if err = binary.Read(r.reader, byteOrder, &size); err != nil {
+		return
+	}
+	if int(size) < rconPacketOverhead || int(size) > maxRCONPacketSize {
+		err = PacketMalformed
+		return
+	}
+
+	packet := make([]byte, size)
+	if _, err = io.ReadFull(r.reader, packet); err != nil {
+		return
+	}
+	id = int32(byteOrder.Uint32(packet[0:4]))
+	ptype = int32(byteOrder.Uint32(packet[4:8]))
+	body = packet[8:]
+
+	if !bytes.HasSuffix(body, []byte{0, 0}) {
+		err = PacketMalformed
+		return
+	}
+	body = body[:len(body)-2]
+	return
+}
@@ -0,0 +1,164 @@
+package goseq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRCONPacket(id, ptype int32, body string) []byte {
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, byteOrder, int32(rconPacketOverhead+len(body)))
+	binary.Write(buf, byteOrder, id)
+	binary.Write(buf, byteOrder, ptype)
+	buf.WriteString(body + "\x00\x00")
+	return buf.Bytes()
+}
+
+// newTestRCON serves Source RCON like srcds: it answers commands with
+// handler's output cut into chunks of at most 16 bytes, and mirrors
+// empty RESPONSE_VALUEs followed by the 0x00000100 packet.
+func newTestRCON(t *testing.T, password string, handler func(command string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					var size, id, ptype int32
+					if binary.Read(reader, byteOrder, &size) != nil {
+						return
+					}
+					binary.Read(reader, byteOrder, &id)
+					binary.Read(reader, byteOrder, &ptype)
+					body := make([]byte, size-8)
+					if _, err := io.ReadFull(reader, body); err != nil {
+						return
+					}
+					command := strings.TrimRight(string(body), "\x00")
+
+					switch {
+					case ptype == rconAuth:
+						conn.Write(testRCONPacket(id, rconResponseValue, ""))
+						if command != password {
+							id = -1
+						}
+						conn.Write(testRCONPacket(id, rconAuthResponse, ""))
+					case ptype == rconResponseValue:
+						conn.Write(testRCONPacket(id, rconResponseValue, ""))
+						conn.Write(testRCONPacket(id, rconResponseValue, "\x00\x00\x00\x01\x00\x00\x00\x00"))
+					default:
+						out := handler(command)
+						for len(out) > 0 {
+							n := min(16, len(out))
+							conn.Write(testRCONPacket(id, rconResponseValue, out[:n]))
+							out = out[n:]
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRCON_Exec(t *testing.T) {
+	status := "hostname: goseq test server\nversion : 1.38.2.2/13822 1575/8853 secure\nmap     : de_dust2\n"
+	addr := newTestRCON(t, "hunter2", func(command string) string {
+		switch command {
+		case "status":
+			return status
+		case "echo hi":
+			return "hi\n"
+		}
+		return "Unknown command \"" + command + "\"\n"
+	})
+
+	r, err := DialRCON(addr, "hunter2", time.Second)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	defer r.Close()
+
+	// twice, so the second skips the trailing packet of the first
+	for i := 0; i < 2; i++ {
+		out, err := r.Exec("status", time.Second)
+		if err != nil || out != status {
+			t.Log("Expected the whole status, got", out, err)
+			t.FailNow()
+		}
+	}
+	if out, err := r.Exec("echo hi", time.Second); err != nil || out != "hi\n" {
+		t.Log("Unexpected output:", out, err)
+		t.FailNow()
+	}
+}
+
+func TestRCON_authFailed(t *testing.T) {
+	addr := newTestRCON(t, "hunter2", func(string) string { return "" })
+
+	_, err := DialRCON(addr, "*******", time.Second)
+	var qerr *QueryError
+	if !errors.Is(err, RCONAuthFailed) || !errors.As(err, &qerr) || qerr.Stage != StageAuth {
+		t.Log("Expected RCONAuthFailed, got", err)
+		t.FailNow()
+	}
+}
+
+func TestRCON_limit(t *testing.T) {
+	addr := newTestRCON(t, "", func(string) string { return strings.Repeat("x", 100) })
+
+	r, err := DialRCON(addr, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetLimits(Limits{MaxRCONResponse: 50})
+
+	if _, err := r.Exec("cvarlist", time.Second); !errors.Is(err, LimitExceeded) {
+		t.Log("Expected LimitExceeded, got", err)
+		t.FailNow()
+	}
+	if _, err := r.Exec("status", time.Second); !errors.Is(err, net.ErrClosed) {
+		t.Log("Expected the connection to be closed, got", err)
+		t.FailNow()
+	}
+}
+
+func TestRCON_cancel(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	addr := newTestRCON(t, "", func(string) string { <-block; return "" })
+
+	r, err := DialRCON(addr, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if _, err := r.ExecContext(ctx, "status"); !errors.Is(err, context.Canceled) {
+		t.Log("Expected context.Canceled, got", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,348 @@
+package goseq
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	OutputMalformed error = errors.New("Command output is malformed.")
+)
+
+// OutputSyntaxError is returned by the RCON output parsers for lines
+// they can't make sense of. It matches OutputMalformed with errors.Is.
+type OutputSyntaxError struct {
+	// Line is the number of the offending line, counting from 1.
+	Line int
+	Text string
+	Msg  string
+}
+
+func (e *OutputSyntaxError) Error() string {
+	return fmt.Sprintf("Command output is malformed at line %d (%q): %s.", e.Line, e.Text, e.Msg)
+}
+
+func (e *OutputSyntaxError) Is(target error) bool { return target == OutputMalformed }
+
+// Status is the output of the status command.
+type Status struct {
+	Hostname string
+	Version  string
+	// Address is the udp/ip line, eg "10.0.0.1:27015".
+	Address string
+	Map     string
+	// PlayerCount is the count the server reports, which may
+	// include players not yet listed.
+	PlayerCount int
+	// Humans and Bots are only set by games that break the
+	// count down, such as CS:GO; they are 0 otherwise.
+	Humans     int
+	Bots       int
+	MaxPlayers int
+	Players    []StatusPlayer
+	// Fields holds every "key : value" line as printed,
+	// for those the struct has no field for.
+	Fields map[string]string
+}
+
+// StatusPlayer is a player line of the status command.
+// Bots have no connection time, ping, loss or address.
+type StatusPlayer struct {
+	UserID int
+	Name   string
+	// SteamID is "BOT" for bots; STEAM_X:Y:Z or [U:1:Z]
+	// depending on the game otherwise.
+	SteamID   string
+	Bot       bool
+	Connected time.Duration
+	Ping      int
+	Loss      int
+	// State is "active", "spawning", "connecting", ...
+	State   string
+	Rate    int
+	Address string
+}
+
+// the players line: "2 humans, 1 bots (20/0 max)" or "2 (16 max)"
+var statusPlayersLine = regexp.MustCompile(`^(\d+)(?: humans?, (\d+) bots?)? \((\d+)(?:/\d+)? max\)`)
+
+// ParseStatus parses the output of the status command of Source
+// games. The key/value header differs between games; what isn't
+// recognised ends up in Fields only.
+func ParseStatus(out string) (*Status, error) {
+	st := &Status{Fields: map[string]string{}}
+
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "#end":
+			continue
+		case strings.HasPrefix(trimmed, "# userid") || strings.HasPrefix(trimmed, "#userid"):
+			// column header
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			player, err := parseStatusPlayer(trimmed)
+			if err != nil {
+				return nil, &OutputSyntaxError{Line: i + 1, Text: line, Msg: err.Error()}
+			}
+			st.Players = append(st.Players, player)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			// a message some games print, such as "---------players--------"
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		st.Fields[key] = value
+
+		switch key {
+		case "hostname":
+			st.Hostname = value
+		case "version":
+			st.Version = value
+		case "udp/ip":
+			st.Address, _, _ = strings.Cut(value, " ")
+		case "map":
+			st.Map, _, _ = strings.Cut(value, " ")
+		case "players":
+			m := statusPlayersLine.FindStringSubmatch(value)
+			if m == nil {
+				return nil, &OutputSyntaxError{Line: i + 1, Text: line, Msg: "unexpected player count"}
+			}
+			st.PlayerCount, _ = strconv.Atoi(m[1])
+			st.MaxPlayers, _ = strconv.Atoi(m[3])
+			if m[2] != "" {
+				st.Humans = st.PlayerCount
+				st.Bots, _ = strconv.Atoi(m[2])
+				st.PlayerCount = st.Humans + st.Bots
+			}
+		}
+	}
+
+	if st.Hostname == "" && st.Map == "" {
+		return nil, &OutputSyntaxError{Line: 1, Text: firstLine(out), Msg: "not the output of status"}
+	}
+	return st, nil
+}
+
+// parseStatusPlayer parses lines such as
+//
+//	#    281 "alice" [U:1:12345] 1:02:03 77 0 active 10.0.0.5:27005
+//	# 3 2 "alice" STEAM_1:0:12345 01:23 45 0 active 786432 10.0.0.5:27005
+//	#  4 "Bot Ted" BOT active 64
+//
+// CS:GO puts the slot after the userid, some games add the rate.
+// Names may contain anything, quotes included, but nothing after
+// them does.
+func parseStatusPlayer(line string) (p StatusPlayer, err error) {
+	start, end := strings.IndexByte(line, '"'), strings.LastIndexByte(line, '"')
+	if start < 0 || end == start {
+		return p, errors.New("missing the quoted name")
+	}
+	p.Name = line[start+1 : end]
+
+	ids := strings.Fields(line[1:start])
+	if len(ids) == 0 || len(ids) > 2 {
+		return p, errors.New("expected a userid before the name")
+	}
+	if p.UserID, err = strconv.Atoi(ids[0]); err != nil {
+		return p, errors.New("bad userid")
+	}
+
+	rest := strings.Fields(line[end+1:])
+	if len(rest) < 2 {
+		return p, errors.New("too few columns")
+	}
+	p.SteamID = rest[0]
+
+	if p.SteamID == "BOT" {
+		p.Bot = true
+		p.State = rest[1]
+		if len(rest) > 2 {
+			p.Rate, _ = strconv.Atoi(rest[2])
+		}
+		return p, nil
+	}
+
+	// uniqueid connected ping loss state [rate] adr
+	if len(rest) < 5 {
+		return p, errors.New("too few columns")
+	}
+	if p.Connected, err = parseConnected(rest[1]); err != nil {
+		return p, err
+	}
+	if p.Ping, err = strconv.Atoi(rest[2]); err != nil {
+		return p, errors.New("bad ping")
+	}
+	if p.Loss, err = strconv.Atoi(rest[3]); err != nil {
+		return p, errors.New("bad loss")
+	}
+	p.State = rest[4]
+
+	switch len(rest) {
+	case 5:
+	case 6:
+		p.Address = rest[5]
+	default:
+		p.Rate, _ = strconv.Atoi(rest[5])
+		p.Address = rest[6]
+	}
+	return p, nil
+}
+
+// parseConnected parses connection times such as "05:12" and "1:02:03".
+func parseConnected(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.New("bad connection time")
+	}
+
+	var d time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, errors.New("bad connection time")
+		}
+		d = 60*d + time.Duration(n)
+	}
+	return d * time.Second, nil
+}
+
+// Convar is a line of the cvarlist command.
+type Convar struct {
+	Name string
+	// Value is the current value, "" for commands.
+	Value string
+	// Command is set for console commands, which have no value.
+	Command bool
+	// Flags are the short flag names, such as "sv", "cheat" or "rep".
+	Flags       []string
+	Description string
+}
+
+// HasFlag reports whether the convar carries flag.
+func (c Convar) HasFlag(flag string) bool {
+	for _, f := range c.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Bool reports whether the value is a number other than 0,
+// which is how the engine reads convars as bools.
+func (c Convar) Bool() bool {
+	f, _ := strconv.ParseFloat(c.Value, 64)
+	return f != 0
+}
+
+func (c Convar) Int() (int, error)       { return strconv.Atoi(c.Value) }
+func (c Convar) Float() (float64, error) { return strconv.ParseFloat(c.Value, 64) }
+
+// ParseCvarlist parses the output of the cvarlist command of Source
+// games, whose lines read
+//
+//	mp_timelimit : 20 : , "nf", "norecord" : game time per map in minutes
+//
+// Values and descriptions may contain " : " themselves; the flags
+// column, empty or starting with a comma, tells them apart.
+func ParseCvarlist(out string) ([]Convar, error) {
+	var convars []Convar
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.Contains(line, " : ") {
+			// "cvar list", dashes, "N total convars/concommands"
+			continue
+		}
+
+		parts := strings.Split(line, " : ")
+		flags := -1
+		for k := 2; k < len(parts); k++ {
+			if f := strings.TrimSpace(parts[k]); f == "" || strings.HasPrefix(f, ",") {
+				flags = k
+				break
+			}
+		}
+		if flags < 0 {
+			return nil, &OutputSyntaxError{Line: i + 1, Text: line, Msg: "missing the flags column"}
+		}
+
+		c := Convar{
+			Name:        strings.TrimSpace(parts[0]),
+			Value:       strings.TrimSpace(strings.Join(parts[1:flags], " : ")),
+			Description: strings.TrimSpace(strings.Join(parts[flags+1:], " : ")),
+		}
+		if c.Value == "cmd" {
+			c.Value, c.Command = "", true
+		}
+		for _, flag := range strings.Split(parts[flags], ",") {
+			if flag = strings.Trim(strings.TrimSpace(flag), `"`); flag != "" {
+				c.Flags = append(c.Flags, flag)
+			}
+		}
+		convars = append(convars, c)
+	}
+	return convars, nil
+}
+
+// ParseMaps returns the map names listed by the maps command,
+// without their ".bsp".
+func ParseMaps(out string) []string {
+	var maps []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if name, ok := strings.CutSuffix(fields[len(fields)-1], ".bsp"); ok {
+			maps = append(maps, name)
+		}
+	}
+	return maps
+}
+
+// User is a line of the users command.
+type User struct {
+	Slot   int
+	UserID int
+	Name   string
+}
+
+// ParseUsers parses the output of the users command, whose lines
+// read `0:2:"alice"`.
+func ParseUsers(out string) ([]User, error) {
+	var users []User
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		slot, rest, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, "<") {
+			// "<slot:userid:"name">" and "2 users"
+			continue
+		}
+
+		userid, name, ok := strings.Cut(rest, ":")
+		u := User{}
+		var err1, err2 error
+		u.Slot, err1 = strconv.Atoi(strings.TrimSpace(slot))
+		u.UserID, err2 = strconv.Atoi(userid)
+		if !ok || err1 != nil || err2 != nil || len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+			return nil, &OutputSyntaxError{Line: i + 1, Text: line, Msg: `expected slot:userid:"name"`}
+		}
+		u.Name = name[1 : len(name)-1]
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
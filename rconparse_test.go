@@ -0,0 +1,214 @@
+package goseq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const testStatusCSGO = `hostname: goseq | Competitive
+version : 1.38.2.2/13822 1575/8853 secure  [G:1:3848011] 
+udp/ip  : 0.0.0.0:27015  (public ip: 203.0.113.7)
+os      :  Linux
+type    :  community dedicated
+map     : de_dust2
+gotv[0]:  port 27020, delay 30.0s, rate 64.0
+players : 2 humans, 2 bots (20/0 max) (not hibernating)
+
+# userid name uniqueid connected ping loss state rate adr
+#  2 1 "GOTV" BOT active 64
+# 3 2 "alice" STEAM_1:0:12345 01:23 45 0 active 786432 198.51.100.5:27005
+# 4 3 "bob: the "builder"" STEAM_1:1:67890 1:02:03 120 2 spawning 196608 198.51.100.6:27005
+#  5 "Bot Ted" BOT active 64
+#end
+`
+
+const testStatusTF2 = `hostname: Valve Matchmaking Server (Washington srcds1012-eat1 #41)
+version : 7970522/24 7970522 secure
+udp/ip  : 162.254.192.75:27015  (public ip: 162.254.192.75)
+steamid : [G:1:3848011] (85568392923936587)
+account : not logged in  (No account specified)
+map     : pl_upward at: 0 x, 0 y, 0 z
+tags    : cp,payload,valve
+players : 2 humans, 0 bots (24 max)
+edicts  : 1056 used of 2048 max
+# userid name                uniqueid            connected ping loss state  adr
+#    281 "alice"             [U:1:12345]          1:02:03   77    0 active 198.51.100.5:27005
+#    282 "Mann Co."          [U:1:67890]          05:12     50    1 connecting 198.51.100.6:27005
+`
+
+const testStatusCSS = "hostname: Counter-Strike: Source\r\n" +
+	"version : 6630498/24 6630498 secure\r\n" +
+	"udp/ip  : 10.0.0.1:27015  (public ip: 203.0.113.9)\r\n" +
+	"map     : de_nuke at: 0 x, 0 y, 0 z\r\n" +
+	"players : 1 (16 max)\r\n" +
+	"\r\n" +
+	"# userid name uniqueid connected ping loss state adr\r\n" +
+	"#      2 \"alice\" STEAM_0:1:12345 10:11 60 0 active 10.0.0.5:27005\r\n"
+
+func TestParseStatus_csgo(t *testing.T) {
+	st, err := ParseStatus(testStatusCSGO)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if st.Hostname != "goseq | Competitive" || st.Map != "de_dust2" || st.Address != "0.0.0.0:27015" {
+		t.Log("Unexpected header:", st.Hostname, st.Map, st.Address)
+		t.FailNow()
+	}
+	if st.PlayerCount != 4 || st.Humans != 2 || st.Bots != 2 || st.MaxPlayers != 20 || st.Fields["type"] != "community dedicated" {
+		t.Log("Unexpected counts:", st.PlayerCount, st.Humans, st.Bots, st.MaxPlayers, st.Fields)
+		t.FailNow()
+	}
+
+	expected := []StatusPlayer{
+		{UserID: 2, Name: "GOTV", SteamID: "BOT", Bot: true, State: "active", Rate: 64},
+		{UserID: 3, Name: "alice", SteamID: "STEAM_1:0:12345", Connected: 83 * time.Second,
+			Ping: 45, Loss: 0, State: "active", Rate: 786432, Address: "198.51.100.5:27005"},
+		{UserID: 4, Name: `bob: the "builder"`, SteamID: "STEAM_1:1:67890", Connected: time.Hour + 2*time.Minute + 3*time.Second,
+			Ping: 120, Loss: 2, State: "spawning", Rate: 196608, Address: "198.51.100.6:27005"},
+		{UserID: 5, Name: "Bot Ted", SteamID: "BOT", Bot: true, State: "active", Rate: 64},
+	}
+	if fmt.Sprint(st.Players) != fmt.Sprint(expected) {
+		t.Log("Expected", expected)
+		t.Log("Got", st.Players)
+		t.FailNow()
+	}
+}
+
+func TestParseStatus_tf2(t *testing.T) {
+	st, err := ParseStatus(testStatusTF2)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if st.Map != "pl_upward" || st.MaxPlayers != 24 || len(st.Players) != 2 || st.Fields["tags"] != "cp,payload,valve" {
+		t.Log("Unexpected status:", st)
+		t.FailNow()
+	}
+	p := st.Players[1]
+	if p.UserID != 282 || p.Name != "Mann Co." || p.SteamID != "[U:1:67890]" || p.Connected != 312*time.Second ||
+		p.Loss != 1 || p.State != "connecting" || p.Rate != 0 || p.Address != "198.51.100.6:27005" {
+		t.Log("Unexpected player:", p)
+		t.FailNow()
+	}
+}
+
+func TestParseStatus_css(t *testing.T) {
+	st, err := ParseStatus(testStatusCSS)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if st.Hostname != "Counter-Strike: Source" || st.Map != "de_nuke" || st.PlayerCount != 1 || st.MaxPlayers != 16 ||
+		st.Humans != 0 || st.Bots != 0 {
+		t.Log("Unexpected status:", st)
+		t.FailNow()
+	}
+	if len(st.Players) != 1 || st.Players[0].Connected != 611*time.Second || st.Players[0].Address != "10.0.0.5:27005" {
+		t.Log("Unexpected players:", st.Players)
+		t.FailNow()
+	}
+}
+
+func TestParseStatus_malformed(t *testing.T) {
+	inputs := map[string]int{
+		"Unknown command \"status\"\n":                         1,
+		"hostname: x\nmap : de_dust2\n# 2 alice STEAM_1:0:1\n": 3,
+		"hostname: x\nplayers : lots\n":                        2,
+		"hostname: x\n# 2 \"alice\" STEAM_1:0:1 1h 5 0 active": 2,
+	}
+	for in, line := range inputs {
+		_, err := ParseStatus(in)
+		var serr *OutputSyntaxError
+		if !errors.As(err, &serr) || !errors.Is(err, OutputMalformed) || serr.Line != line {
+			t.Log("Expected an error at line", line, "for", in, "got", err)
+			t.FailNow()
+		}
+	}
+}
+
+const testCvarlistCSGO = `cvar list
+--------------
+_autosave                                : cmd      :                  : Autosave
+ammo_grenade_limit_total                 : 3        : , "sv", "rep"    : 
+bot_quota                                : 10       : , "sv", "rep"    : Determines the total number of bots in the game.
+hostname                                 : goseq : de_dust2 : , "sv"   : Hostname for server.
+mp_friendlyfire                          : 1        : , "sv", "nf", "rep" : Allows team members to injure other members of their team
+sv_cheats                                : 0        : , "sv", "nf", "rep" : Allow cheats on server
+sv_password                              :          : , "sv", "nf", "prot", "norecord" : Server password for entry into multiplayer games
+--------------
+ 7 total convars/concommands
+`
+
+const testCvarlistTF2 = `cvar list
+--------------
+mp_timelimit                             : 20       : , "nf", "norecord" : game time per map in minutes
+tf_bot_difficulty                        : 1        : , "sv"           : Defines the skill of bots joining the game.  Values are: 0=easy, 1=normal, 2=hard, 3=expert.
+sv_gravity                               : 800      : , "nf", "rep"    : World gravity.
+--------------
+  3 total convars/concommands
+`
+
+func TestParseCvarlist(t *testing.T) {
+	convars, err := ParseCvarlist(testCvarlistCSGO)
+	if err != nil || len(convars) != 7 {
+		t.Log("Expected 7 convars, got", len(convars), err)
+		t.FailNow()
+	}
+
+	autosave, hostname, ff, password := convars[0], convars[3], convars[4], convars[6]
+	if !autosave.Command || autosave.Value != "" || len(autosave.Flags) != 0 || autosave.Description != "Autosave" {
+		t.Log("Unexpected command:", autosave)
+		t.FailNow()
+	}
+	if hostname.Value != "goseq : de_dust2" || !hostname.HasFlag("sv") {
+		t.Log("Unexpected hostname:", hostname)
+		t.FailNow()
+	}
+	if n, err := ff.Int(); err != nil || n != 1 || !ff.Bool() || !ff.HasFlag("rep") || ff.HasFlag("cheat") {
+		t.Log("Unexpected mp_friendlyfire:", ff)
+		t.FailNow()
+	}
+	if password.Name != "sv_password" || password.Value != "" || !password.HasFlag("prot") {
+		t.Log("Unexpected sv_password:", password)
+		t.FailNow()
+	}
+
+	convars, err = ParseCvarlist(testCvarlistTF2)
+	if err != nil || len(convars) != 3 {
+		t.Log("Expected 3 convars, got", len(convars), err)
+		t.FailNow()
+	}
+	if g, err := convars[2].Float(); err != nil || g != 800 || convars[1].Description[len(convars[1].Description)-7:] != "expert." {
+		t.Log("Unexpected convars:", convars)
+		t.FailNow()
+	}
+
+	if _, err = ParseCvarlist("sv_cheats : 0 : Allow cheats"); !errors.Is(err, OutputMalformed) {
+		t.Log("Expected OutputMalformed, got", err)
+		t.FailNow()
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	out := "-------------\nPENDING:   (fs) cs_office.bsp\nPENDING:   (fs) de_dust2.bsp\n"
+	if maps := ParseMaps(out); fmt.Sprint(maps) != "[cs_office de_dust2]" {
+		t.Log("Unexpected maps:", maps)
+		t.FailNow()
+	}
+}
+
+func TestParseUsers(t *testing.T) {
+	out := "<slot:userid:\"name\">\n0:2:\"alice\"\n1:3:\"bob:x\"\n2 users\n"
+	users, err := ParseUsers(out)
+	if err != nil || fmt.Sprint(users) != "[{0 2 alice} {1 3 bob:x}]" {
+		t.Log("Unexpected users:", users, err)
+		t.FailNow()
+	}
+	if _, err := ParseUsers("0:two:\"alice\""); !errors.Is(err, OutputMalformed) {
+		t.Log("Expected OutputMalformed, got", err)
+		t.FailNow()
+	}
+}
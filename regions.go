@@ -0,0 +1,126 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// AllRegions lists every Region, in wire order.
+	AllRegions []Region = []Region{
+		USEast, USWest, SouthAmerica, Europe, Asia,
+		Australia, MiddleEast, Africa, RestOfWorld,
+	}
+)
+
+func (r Region) String() string {
+	switch r {
+	case USEast:
+		return "US East"
+	case USWest:
+		return "US West"
+	case SouthAmerica:
+		return "South America"
+	case Europe:
+		return "Europe"
+	case Asia:
+		return "Asia"
+	case Australia:
+		return "Australia"
+	case MiddleEast:
+		return "Middle East"
+	case Africa:
+		return "Africa"
+	case RestOfWorld:
+		return "Rest of World"
+	}
+	return fmt.Sprintf("Region(0x%02X)", byte(r))
+}
+
+// RegionalServer is a server found by a multi-region crawl,
+// tagged with every region it was listed under.
+type RegionalServer struct {
+	Server
+	Regions []Region
+}
+
+// RegionCrawlResult merges the crawls of several regions.
+type RegionCrawlResult struct {
+	// Servers lists every address once, in the order of the
+	// regions asked for and then of the pages they came on.
+	Servers []RegionalServer
+	// Regions holds the page count, completeness and pacing
+	// of each region's crawl. Their Servers are left empty.
+	Regions map[Region]*CrawlResult
+}
+
+func (m *master) CrawlRegions(ctx context.Context, regions []Region, opts CrawlOptions) (*RegionCrawlResult, error) {
+	if len(regions) == 0 {
+		regions = AllRegions
+	}
+	regions = uniqueRegions(regions)
+
+	type crawled struct {
+		result *CrawlResult
+		err    error
+	}
+	crawls := make([]crawled, len(regions))
+
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func(i int, region Region) {
+			defer wg.Done()
+			// one snapshot, and so one socket, per region
+			q := m.snapshot()
+			q.region = region
+			defer q.closeConnection()
+			crawls[i].result, crawls[i].err = q.crawl(ctx, opts)
+		}(i, region)
+	}
+	wg.Wait()
+
+	merged := &RegionCrawlResult{Regions: make(map[Region]*CrawlResult)}
+	index := make(map[string]int)
+	var errs []error
+
+	for i, region := range regions {
+		result := crawls[i].result
+		if crawls[i].err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", region, crawls[i].err))
+		}
+
+		for _, s := range result.Servers {
+			if at, ok := index[s.Address()]; ok {
+				tags := merged.Servers[at].Regions
+				if tags[len(tags)-1] != region {
+					merged.Servers[at].Regions = append(tags, region)
+				}
+				continue
+			}
+			index[s.Address()] = len(merged.Servers)
+			merged.Servers = append(merged.Servers, RegionalServer{Server: s, Regions: []Region{region}})
+		}
+
+		result.Servers = nil
+		merged.Regions[region] = result
+	}
+
+	return merged, errors.Join(errs...)
+}
+
+// uniqueRegions drops the regions listed more than once,
+// keeping the first of each.
+func uniqueRegions(regions []Region) []Region {
+	seen := make(map[Region]bool, len(regions))
+	unique := make([]Region, 0, len(regions))
+	for _, region := range regions {
+		if !seen[region] {
+			seen[region] = true
+			unique = append(unique, region)
+		}
+	}
+	return unique
+}
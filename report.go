@@ -0,0 +1,38 @@
+package goseq
+
+import (
+	"context"
+)
+
+// QueryReport tells how a single query went. Pass one to a query
+// with WithQueryReport; it is filled in once the query returns,
+// whether it failed or not.
+//
+// A report belongs to the query it was passed to, so queries
+// running side by side, on the same Server or not, each need
+// their own.
+type QueryReport struct {
+	// Handshake is the path taken by the last Info, Players or
+	// Rules attempt that got an answer; HandshakeNone otherwise.
+	Handshake HandshakePath
+	// Attempts is how many times the query was sent,
+	// see RetryPolicy.
+	Attempts int
+}
+
+type queryReportKey struct{}
+
+// WithQueryReport returns a copy of ctx that makes the queries it
+// is passed to fill in report.
+func WithQueryReport(ctx context.Context, report *QueryReport) context.Context {
+	return context.WithValue(ctx, queryReportKey{}, report)
+}
+
+// reportFor returns the report attached to ctx, or one
+// that goes nowhere.
+func reportFor(ctx context.Context) *QueryReport {
+	if report, ok := ctx.Value(queryReportKey{}).(*QueryReport); ok && report != nil {
+		return report
+	}
+	return &QueryReport{}
+}
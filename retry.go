@@ -0,0 +1,145 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how often a query is sent again after an
+// attempt fails, typically because a datagram got lost on the way.
+// Every attempt starts afresh, challenge included.
+//
+// The zero RetryPolicy makes a single attempt.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a query is sent at most.
+	MaxAttempts int
+	// AttemptTimeout bounds each attempt. When zero, the time left
+	// to the query's context is split evenly between the attempts
+	// left to make.
+	AttemptTimeout time.Duration
+	// Backoff is the wait before the second attempt. It doubles
+	// with every further attempt, up to MaxBackoff, and gets up to
+	// half of itself added as jitter.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether an attempt that failed with err
+	// should be retried; IsRetryable when nil.
+	Retryable func(err error) bool
+}
+
+var (
+	// NoRetry makes a single attempt.
+	NoRetry RetryPolicy = RetryPolicy{MaxAttempts: 1}
+	// DefaultRetryPolicy suits queries over the internet.
+	DefaultRetryPolicy RetryPolicy = RetryPolicy{
+		MaxAttempts:    3,
+		AttemptTimeout: time.Second,
+		Backoff:        100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+)
+
+// IsRetryable reports whether err is worth another attempt: the
+// server stayed silent, lost part of a split response or sent a
+// datagram larger than expected. Cancelled queries, refused
+// connections and malformed responses are not.
+func IsRetryable(err error) bool {
+	return errors.Is(err, Timeout) ||
+		errors.Is(err, PacketMissing) ||
+		errors.Is(err, PacketTruncated)
+}
+
+func (p RetryPolicy) attempts() int { return max(p.MaxAttempts, 1) }
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the wait before attempt, counting from 0.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.Backoff <= 0 || attempt == 0 {
+		return 0
+	}
+
+	wait := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 {
+		wait = min(wait, p.MaxBackoff)
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// attemptContext bounds the attempt-th attempt, counting from 0.
+func (p RetryPolicy) attemptContext(ctx context.Context, attempt int) (context.Context, context.CancelFunc) {
+	if p.AttemptTimeout > 0 {
+		return context.WithTimeout(ctx, p.AttemptTimeout)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		left := p.attempts() - attempt
+		return context.WithTimeout(ctx, time.Until(deadline)/time.Duration(left))
+	}
+	return context.WithCancel(ctx)
+}
+
+// retry runs attempt as the server's RetryPolicy allows, recording
+// the number of attempts made in the query's report and in the
+// returned *QueryError.
+func (s *iserver) retry(ctx context.Context, attempt func(context.Context) error) error {
+	policy := s.retryPolicy
+
+	var err error
+	attempts := 0
+	defer func() { reportFor(ctx).Attempts = attempts }()
+
+	for n := 0; n < policy.attempts(); n++ {
+		if n > 0 {
+			if !policy.retryable(err) {
+				break
+			}
+			if sleepContext(ctx, policy.backoff(n)) != nil {
+				// Out of time, the last attempt tells why;
+				// cancelled, the context does.
+				if ctx.Err() == context.Canceled {
+					err = stageErr(StageRead, nil, ctx.Err())
+				}
+				break
+			}
+		}
+
+		actx, cancel := policy.attemptContext(ctx, n)
+		err = attempt(actx)
+		cancel()
+
+		attempts = n + 1
+		if err == nil {
+			return nil
+		}
+	}
+
+	qerr := stageErr(StageConnect, nil, err).(*QueryError)
+	qerr.Attempts = attempts
+	return qerr
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,137 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLossyResponder ignores the first drop requests.
+func testLossyResponder(t *testing.T, drop int32) *testResponder {
+	var seen atomic.Int32
+	return newTestResponder(t, func(req []byte) [][]byte {
+		if seen.Add(1) <= drop {
+			return nil
+		}
+		return [][]byte{testInfoResponse()}
+	})
+}
+
+func TestServer_retry(t *testing.T) {
+	r := testLossyResponder(t, 1)
+	s := r.Server()
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, AttemptTimeout: 50 * time.Millisecond, Backoff: time.Millisecond})
+
+	report := &QueryReport{}
+	info, err := s.InfoContext(testReportContext(t, report))
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	checkTestInfo(t, info)
+	if report.Attempts != 2 {
+		t.Log("Expected 2 attempts, got", report.Attempts)
+		t.FailNow()
+	}
+}
+
+func TestServer_retryExhausted(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+	s := silent.Server()
+	// no AttemptTimeout: the 300ms are split between attempts
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+
+	start := time.Now()
+	_, err := s.Info(300 * time.Millisecond)
+
+	var qerr *QueryError
+	if !errors.As(err, &qerr) || !errors.Is(err, Timeout) || qerr.Attempts != 3 {
+		t.Log("Expected a Timeout after 3 attempts, got", err)
+		t.FailNow()
+	}
+	if time.Since(start) > time.Second {
+		t.Log("Retries did not honour the timeout.")
+		t.FailNow()
+	}
+}
+
+func TestServer_retryNotRetryable(t *testing.T) {
+	var seen atomic.Int32
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		seen.Add(1)
+		return [][]byte{[]byte("\xFF\xFF\xFF\xFF\x49\x11not enough")}
+	})
+	s := r.Server()
+	s.SetRetryPolicy(DefaultRetryPolicy)
+
+	report := &QueryReport{}
+	_, err := s.InfoContext(testReportContext(t, report))
+	if err == nil || report.Attempts != 1 || seen.Load() != 1 {
+		t.Log("A malformed response should not be retried, got", report.Attempts, "attempts:", err)
+		t.FailNow()
+	}
+}
+
+func TestServer_retryCancel(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+	s := silent.Server()
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, AttemptTimeout: 10 * time.Millisecond, Backoff: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	report := &QueryReport{}
+	_, err := s.InfoContext(WithQueryReport(ctx, report))
+	var qerr *QueryError
+	if !errors.Is(err, context.Canceled) || report.Attempts != 1 || !errors.As(err, &qerr) || qerr.Attempts != 1 {
+		t.Log("Expected the backoff to be cancelled, got", report.Attempts, err)
+		t.FailNow()
+	}
+}
+
+func TestBulk_retry(t *testing.T) {
+	r := testLossyResponder(t, 2)
+	b, err := NewBulk(BulkOptions{
+		Timeout: time.Second,
+		Retry:   RetryPolicy{MaxAttempts: 3, AttemptTimeout: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for result := range b.Query(context.Background(), []string{r.Address()}) {
+		if result.Err != nil || result.Attempts != 3 {
+			t.Log("Expected success on the third attempt, got", result.Attempts, result.Err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSession_retryConcurrent(t *testing.T) {
+	r := testLossyResponder(t, 0)
+	s := NewSession()
+	defer s.Close()
+	s.SetAddress(r.Address())
+	s.SetRetryPolicy(DefaultRetryPolicy)
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			report := &QueryReport{}
+			_, err := s.InfoContext(testReportContext(t, report))
+			if err == nil && report.Attempts != 1 {
+				err = errors.New("expected a single attempt")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Log("Unexpected error:", err)
+			t.FailNow()
+		}
+	}
+}
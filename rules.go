@@ -2,77 +2,68 @@ package goseq
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
-	"time"
+)
+
+const (
+	tRulesPacketReqID  byte = 0x56 // "V"
+	tRulesPacketRespID byte = 0x45 // "E"
 )
 
 // Rules is a key-value pair of
 // convar settings for the server.
 type RuleMap map[string]string
 
-func (serv *iserver) Rules(limit time.Duration) (rmap RuleMap, err error) {
-	timer := time.NewTimer(limit)
-	done := make(chan bool)
-
-	go func() { rmap, err = serv.get_rules(); done <- true }()
-
-	select {
-	case <-timer.C:
-		return nil, Timeout
-	case <-done:
-		return
+func (serv *iserver) RulesContext(ctx context.Context) (rmap RuleMap, err error) {
+	err = serv.retry(ctx, func(ctx context.Context) error {
+		rmap, err = serv.get_rules(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, queryErr(serv.Address(), RulesRequest, err)
 	}
+	return rmap, nil
 }
 
-func (serv *iserver) get_rules() (rmap RuleMap, err error) {
-	rmap = newRuleMap()
-	var challenge int32
-
-	if challenge, err = serv.getChallenge(byte('V')); err != nil {
-		return
-	}
+func newRulesRequestBA(chalValue int32) []byte {
+	return newWrappedChallengeBA(tRulesPacketReqID, chalValue)
+}
 
+func (serv *iserver) get_rules(ctx context.Context) (rmap RuleMap, err error) {
 	conn, err := serv.getConnection()
 	if err != nil {
 		return
 	}
+	defer conn.Close()
+	defer bindContext(ctx, conn)()
 
-	buf := bytes.NewBuffer(packetHeader[0:])
-	chal := wrRuleReq{Header: byte('V'), Challenge: challenge}
-
-	if err = binary.Write(buf, byteOrder, chal); err != nil {
+	payload, path, err := serv.handshake(ctx, conn, newRulesRequestBA, []byte{tRulesPacketRespID}, true)
+	if err != nil {
 		return
 	}
+	reportFor(ctx).Handshake = path
 
-	chal_bytes := buf.Bytes()
-
-	if _, err = conn.Write(chal_bytes); err != nil {
-		return
+	if rmap, err = decodeRules(payload, serv.limits.orDefault()); err != nil {
+		err = stageErr(StageDecode, payload, err)
 	}
+	return
+}
 
-	st := newPacketStream()
-	if err = st.Gobble(conn); err != nil {
-		return
-	}
+func decodeRules(payload []byte, limits Limits) (rmap RuleMap, err error) {
+	rmap = newRuleMap()
 
-	payload, err := st.GetFullPayload()
-	if err != nil {
+	buf := bytes.NewBuffer(payload)
+	rsp := wrRuleResponse{}
+	if err = binary.Read(buf, byteOrder, &rsp); err != nil {
 		return
 	}
 
-	buf = bytes.NewBuffer(payload)
-	var rsp_wrapped struct {
-		Header [4]byte
-		wrRuleResponse
-	}
-	if err = binary.Read(buf, byteOrder, &rsp_wrapped); err != nil {
+	if rsp.NumRules < 0 {
+		err = PacketMalformed
 		return
 	}
-
-	rsp := rsp_wrapped.wrRuleResponse
-
-	if rsp.Header != byte('E') {
-		err = PacketHeaderErr
+	if err = checkLimit("MaxRules", limits.MaxRules, int(rsp.NumRules)); err != nil {
 		return
 	}
 
@@ -101,11 +92,6 @@ func newRuleMap() RuleMap {
 	return make(RuleMap)
 }
 
-type wrRuleReq struct {
-	Header    byte
-	Challenge int32
-}
-
 type wrRuleResponse struct {
 	Header   byte
 	NumRules int16
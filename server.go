@@ -1,8 +1,10 @@
 package goseq
 
 import (
+	"context"
 	"errors"
-	"io"
+	"net"
+	"sync"
 	"time"
 )
 
@@ -24,6 +26,21 @@ const (
 	Mac     ServerEnvironment = ServerEnvironment(byte('o'))
 )
 
+// Engine is the game engine that answered a query.
+type Engine byte
+
+const (
+	SourceEngine  Engine = iota
+	GoldSrcEngine        // Half-Life 1 and its mods
+)
+
+func (e Engine) String() string {
+	if e == GoldSrcEngine {
+		return "GoldSrc"
+	}
+	return "Source"
+}
+
 const (
 	// NoAddress represents a address that has yet to be
 	// set by the server implementation.
@@ -35,17 +52,41 @@ var (
 )
 
 // Server represents a Source server.
+//
+// Every query comes in two flavours: one taking a timeout and one
+// taking a context.Context. The timeout variants are shorthand for
+// calling the context variants with context.WithTimeout.
+// Queries fail with a *QueryError.
 type Server interface {
 	Address() string
 	// Ping returns the connection latency of a server.
 	Ping(timeout time.Duration) (time.Duration, error)
+	PingContext(ctx context.Context) (time.Duration, error)
 	// Info returns the Source Info query result.
 	Info(timeout time.Duration) (ServerInfo, error)
+	InfoContext(ctx context.Context) (ServerInfo, error)
 	// Players retrieves the players currently on a server.
 	Players(timeout time.Duration) ([]Player, error)
+	PlayersContext(ctx context.Context) ([]Player, error)
 	// Rules returns the server-defined rules of the server.
 	// These are mostly Convar settings.
 	Rules(timeout time.Duration) (RuleMap, error)
+	RulesContext(ctx context.Context) (RuleMap, error)
+	// SetAppID tells the server which game it runs, so that split
+	// packet quirks registered for it apply before Info has been
+	// queried. Info sets it as well.
+	SetAppID(appID int16)
+	// SetMaxDatagramSize sets the largest datagram the server is
+	// expected to send; MaxDatagramSize by default. Larger datagrams
+	// fail with PacketTruncated and double the size for later queries.
+	SetMaxDatagramSize(size int)
+	// SetLimits caps what a response may make the server allocate.
+	// Responses over a limit fail with a *LimitError.
+	SetLimits(Limits)
+	// SetRetryPolicy sets how often failed queries are sent again;
+	// once by default. QueryError and QueryReport tell how many
+	// attempts a query took.
+	SetRetryPolicy(RetryPolicy)
 	SetAddress(string) error
 }
 
@@ -60,15 +101,119 @@ func NewServer() Server {
 // implementation of Server
 type iserver struct {
 	src source
+	// mu guards what queries learn about the server,
+	// so that queries may run side by side
+	mu sync.Mutex
+	// learned from Info or set by the caller,
+	// used to look up split quirks
+	appID    int16
+	protocol byte
+	// 0 means MaxDatagramSize
+	maxDatagramSize int
+	// zero fields mean DefaultLimits
+	limits      Limits
+	retryPolicy RetryPolicy
+}
+
+func (serv *iserver) Address() string           { return serv.src.address() }
+func (s *iserver) SetAddress(a string) error    { return s.src.setAddress(a) }
+func (s *iserver) SetLimits(l Limits)           { s.limits = l }
+func (s *iserver) SetRetryPolicy(p RetryPolicy) { s.retryPolicy = p }
+
+func (s *iserver) SetAppID(appID int16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appID = appID
+}
+
+func (s *iserver) SetMaxDatagramSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDatagramSize = size
+}
+
+// setGame remembers the game Info reported.
+func (s *iserver) setGame(appID int16, protocol byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appID, s.protocol = appID, protocol
 }
 
-func (serv *iserver) Address() string        { return serv.src.address() }
-func (s *iserver) SetAddress(a string) error { return s.src.setAddress(a) }
+func (s *iserver) datagramSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.datagram_size()
+}
+
+// datagram_size is datagramSize with mu held.
+func (s *iserver) datagram_size() int {
+	if s.maxDatagramSize <= 0 || s.maxDatagramSize > MaxDatagramSize {
+		return MaxDatagramSize
+	}
+	return s.maxDatagramSize
+}
 
-func (s *iserver) getConnection() (io.ReadWriteCloser, error) {
+// growDatagramSize doubles the maximum datagram size.
+func (s *iserver) growDatagramSize() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDatagramSize = min(2*s.datagram_size(), MaxDatagramSize)
+}
+
+func (s *iserver) splitLayout() splitLayout {
+	s.mu.Lock()
+	appID, protocol := s.appID, s.protocol
+	s.mu.Unlock()
+	return LookupSplitQuirk(appID, protocol).layout()
+}
+
+func (s *iserver) getConnection() (net.Conn, error) {
 	return s.src.connection()
 }
 
+// receive returns the reassembled payload of the next reply on conn.
+// A truncated datagram grows the server's maximum datagram size,
+// so that the next query gets all of it.
+func (s *iserver) receive(ctx context.Context, conn net.Conn) ([]byte, error) {
+	st := newPacketStreamFor(s.splitLayout(), s.datagramSize(), s.limits)
+	if err := st.Gobble(conn); err != nil {
+		if err == PacketTruncated {
+			s.growDatagramSize()
+		}
+		return nil, stageErr(StageRead, st.last, contextErr(ctx, err))
+	}
+
+	payload, err := st.GetFullPayload()
+	if err != nil {
+		return nil, stageErr(StageDecode, st.contiguous_payload(), err)
+	}
+	return payload, nil
+}
+
+func (s *iserver) Ping(timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.PingContext(ctx)
+}
+
+func (s *iserver) Info(timeout time.Duration) (ServerInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.InfoContext(ctx)
+}
+
+func (s *iserver) Players(timeout time.Duration) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.PlayersContext(ctx)
+}
+
+func (s *iserver) Rules(timeout time.Duration) (RuleMap, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.RulesContext(ctx)
+}
+
 type wrChallengeResponse struct {
 	Magic [4]byte
 }
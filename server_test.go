@@ -0,0 +1,97 @@
+package goseq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// testResponder answers every datagram it receives with the
+// datagrams returned by handler. A nil result sends nothing.
+type testResponder struct {
+	conn *net.UDPConn
+}
+
+func newTestResponder(t *testing.T, handler func(request []byte) [][]byte) *testResponder {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		var buffer [65535]byte
+		for {
+			n, from, err := conn.ReadFromUDP(buffer[0:])
+			if err != nil {
+				return
+			}
+			for _, reply := range handler(append([]byte(nil), buffer[0:n]...)) {
+				conn.WriteToUDP(reply, from)
+			}
+		}
+	}()
+
+	return &testResponder{conn: conn}
+}
+
+func (r *testResponder) Address() string { return r.conn.LocalAddr().String() }
+
+func (r *testResponder) Server() Server {
+	s := NewServer()
+	s.SetAddress(r.Address())
+	return s
+}
+
+func TestServer_InfoContext_timeout(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+
+	start := time.Now()
+	_, err := silent.Server().Info(50 * time.Millisecond)
+	if !errors.Is(err, Timeout) {
+		t.Log("Expected Timeout, got:", err)
+		t.FailNow()
+	}
+	if time.Since(start) > time.Second {
+		t.Log("Info did not honour its timeout.")
+		t.FailNow()
+	}
+}
+
+func TestServer_InfoContext_cancel(t *testing.T) {
+	silent := newTestResponder(t, func([]byte) [][]byte { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := silent.Server().InfoContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Log("Expected context.Canceled, got:", err)
+		t.FailNow()
+	}
+}
+
+func TestServer_concurrentQueries(t *testing.T) {
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		if len(req) > 4 && req[4] == tRulesPacketReqID {
+			return [][]byte{testRulesResponse()}
+		}
+		return [][]byte{testInfoResponse()}
+	})
+	s := r.Server()
+
+	errs := make(chan error, 4)
+	go func() { _, err := s.Info(time.Second); errs <- err }()
+	go func() { _, err := s.Rules(time.Second); errs <- err }()
+	go func() { s.SetAppID(730); errs <- nil }()
+	go func() { s.SetMaxDatagramSize(1400); errs <- nil }()
+
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Log("Unexpected error:", err)
+			t.FailNow()
+		}
+	}
+}
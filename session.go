@@ -0,0 +1,133 @@
+package goseq
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ChallengeLifetime is how long a Session trusts a challenge
+	// before asking the server for a new one.
+	ChallengeLifetime time.Duration = 30 * time.Second
+)
+
+// Session is a Server that keeps a single UDP socket open to its
+// address for as long as it lives. Challenges are requested and
+// redeemed from the same source port, and the last challenge the
+// server handed out is reused by later Players and Rules queries.
+//
+// Queries on a Session are serialised; it is safe to share one
+// between goroutines.
+type Session interface {
+	Server
+	// Close releases the session's socket. It waits for a query
+	// in progress to finish.
+	Close() error
+}
+
+// NewSession returns a Session that uses the network
+// as its data source.
+func NewSession() Session {
+	return &isession{
+		iserver: iserver{
+			src: &sessionSource{},
+		},
+	}
+}
+
+// implementation of Session
+type isession struct {
+	iserver
+}
+
+func (s *isession) Close() error {
+	return s.src.(*sessionSource).close()
+}
+
+// sessionSource is a sourceRemote whose
+// connection outlives a single query.
+type sessionSource struct {
+	sourceRemote
+	// held while a query owns conn
+	mu   sync.Mutex
+	conn net.Conn
+	// what the queries on conn were after
+	requests requestLog
+
+	chmu        sync.Mutex
+	challenge   int32
+	challengeAt time.Time
+}
+
+func (s *sessionSource) setAddress(a string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeConnection()
+	return s.sourceRemote.setAddress(a)
+}
+
+func (s *sessionSource) connection() (net.Conn, error) {
+	s.mu.Lock()
+	if s.conn == nil {
+		conn, err := s.sourceRemote.connection()
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.conn = conn
+	}
+	// a previous query may have left an expired deadline behind
+	s.conn.SetDeadline(time.Time{})
+	return &sessionConn{Conn: s.conn, src: s}, nil
+}
+
+func (s *sessionSource) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeConnection()
+}
+
+func (s *sessionSource) closeConnection() (err error) {
+	if s.conn != nil {
+		err = s.conn.Close()
+		s.conn = nil
+	}
+	s.requests = requestLog{}
+	s.chmu.Lock()
+	s.challengeAt = time.Time{}
+	s.chmu.Unlock()
+	return
+}
+
+// sessionConn is the session's socket on loan to a single query.
+// Closing it returns the socket to the session instead of closing it.
+type sessionConn struct {
+	net.Conn
+	src  *sessionSource
+	once sync.Once
+}
+
+func (c *sessionConn) Close() error {
+	c.once.Do(c.src.mu.Unlock)
+	return nil
+}
+
+func (c *sessionConn) expect(want []byte)    { c.src.requests.expect(want) }
+func (c *sessionConn) late(header byte) bool { return c.src.requests.late(header) }
+
+func (c *sessionConn) cachedChallenge() (int32, bool) {
+	c.src.chmu.Lock()
+	defer c.src.chmu.Unlock()
+	if c.src.challengeAt.IsZero() || time.Since(c.src.challengeAt) > ChallengeLifetime {
+		return -1, false
+	}
+	return c.src.challenge, true
+}
+
+func (c *sessionConn) storeChallenge(chalValue int32) {
+	c.src.chmu.Lock()
+	defer c.src.chmu.Unlock()
+	c.src.challenge = chalValue
+	c.src.challengeAt = time.Now()
+}
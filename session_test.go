@@ -0,0 +1,171 @@
+package goseq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSessionResponder accepts only the challenge currently stored
+// in valid and counts how many challenges it had to hand out.
+func testSessionResponder(t *testing.T, valid *atomic.Int32, issued *atomic.Int32) *testResponder {
+	return newTestResponder(t, func(req []byte) [][]byte {
+		var got int32
+		if len(req) < 9 || binary.Read(bytes.NewBuffer(req[5:9]), byteOrder, &got) != nil {
+			return nil
+		}
+		if got != valid.Load() {
+			issued.Add(1)
+			return [][]byte{testChallengeResponse(valid.Load())}
+		}
+		switch req[4] {
+		case tPlayersPacketReqID:
+			return [][]byte{testPlayersResponse()}
+		case tRulesPacketReqID:
+			return [][]byte{testRulesResponse()}
+		}
+		return nil
+	})
+}
+
+func TestSession_reusesChallenge(t *testing.T) {
+	var valid, issued atomic.Int32
+	valid.Store(777)
+	r := testSessionResponder(t, &valid, &issued)
+
+	s := NewSession()
+	defer s.Close()
+	s.SetAddress(r.Address())
+
+	report := &QueryReport{}
+	if _, err := s.PlayersContext(testReportContext(t, report)); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if report.Handshake != HandshakeChallenged {
+		t.Log("Expected first query to be challenged, got", report.Handshake)
+		t.FailNow()
+	}
+
+	report = &QueryReport{}
+	if _, err := s.RulesContext(testReportContext(t, report)); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if report.Handshake != HandshakeCached || issued.Load() != 1 {
+		t.Log("Expected cached challenge to be reused, got", report.Handshake, "after", issued.Load(), "challenges")
+		t.FailNow()
+	}
+}
+
+func TestSession_rejectedChallenge(t *testing.T) {
+	var valid, issued atomic.Int32
+	valid.Store(777)
+	r := testSessionResponder(t, &valid, &issued)
+
+	s := NewSession()
+	defer s.Close()
+	s.SetAddress(r.Address())
+
+	if _, err := s.Players(time.Second); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+
+	// the server rotates its challenge; the cached one is stale now
+	valid.Store(888)
+
+	report := &QueryReport{}
+	rules, err := s.RulesContext(testReportContext(t, report))
+	if err != nil || rules["sv_cheats"] != "0" {
+		t.Log("Unexpected result:", rules, err)
+		t.FailNow()
+	}
+	if report.Handshake != HandshakeChallenged || issued.Load() != 2 {
+		t.Log("Expected a fresh challenge, got", report.Handshake, "after", issued.Load(), "challenges")
+		t.FailNow()
+	}
+}
+
+// A query cancelled while another waits for the socket keeps it
+// until it returns; the reply it never read doesn't fool the next one.
+func TestSession_cancelWhileShared(t *testing.T) {
+	asked := make(chan struct{}, 1)
+	pending := false
+	r := newTestResponder(t, func(req []byte) [][]byte {
+		switch req[4] {
+		case tPlayersPacketReqID:
+			// answered late, along with the next request
+			pending = true
+			asked <- struct{}{}
+			return nil
+		case tInfoPacketReqID:
+			var replies [][]byte
+			if pending {
+				replies = append(replies, testPlayersResponse())
+				pending = false
+			}
+			return append(replies, testInfoResponse())
+		}
+		return nil
+	})
+
+	s := NewSession()
+	defer s.Close()
+	s.SetAddress(r.Address())
+
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelled := make(chan error, 1)
+		go func() {
+			_, err := s.PlayersContext(ctx)
+			cancelled <- err
+		}()
+		<-asked
+
+		info := make(chan error, 1)
+		go func() {
+			got, err := s.Info(time.Second)
+			if err == nil && got.GetName() != "goseq test server" {
+				err = errors.New("unexpected info " + got.GetName())
+			}
+			info <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		if err := <-cancelled; !errors.Is(err, context.Canceled) {
+			t.Log("Expected context.Canceled, got:", err)
+			t.FailNow()
+		}
+		if err := <-info; err != nil {
+			t.Log("Unexpected error:", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSession_unexpectedReply(t *testing.T) {
+	r := newTestResponder(t, func([]byte) [][]byte {
+		return [][]byte{testRulesResponse()}
+	})
+
+	s := NewSession()
+	defer s.Close()
+	s.SetAddress(r.Address())
+
+	// nothing was asked of the fresh socket before
+	start := time.Now()
+	if _, err := s.Players(time.Second); !errors.Is(err, PacketMalformed) {
+		t.Log("Expected PacketMalformed, got:", err)
+		t.FailNow()
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Log("The unexpected reply was not reported at once.")
+		t.FailNow()
+	}
+}
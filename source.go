@@ -1,8 +1,10 @@
 package goseq
 
 import (
-	"io"
+	"context"
 	"net"
+	"sync"
+	"time"
 )
 
 // source allows us to mock a
@@ -10,25 +12,36 @@ import (
 type source interface {
 	address() string
 	setAddress(string) error
-	connection() (io.ReadWriteCloser, error)
+	connection() (net.Conn, error)
 }
 
 // sourceRemote is a connection
 // to a foreign server.
 type sourceRemote struct {
+	// guards the address against queries
+	// running side by side
+	mu     sync.Mutex
 	ip     string
 	remote *net.UDPAddr
 }
 
-func (src *sourceRemote) address() string { return src.ip }
+func (src *sourceRemote) address() string {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.ip
+}
 
 func (s *sourceRemote) setAddress(a string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.ip = a
 	s.remote = nil
 	return nil
 }
 
-func (s *sourceRemote) connection() (io.ReadWriteCloser, error) {
+func (s *sourceRemote) connection() (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.ip == NoAddress || s.ip == "" {
 		return nil, NoAddressSet
 	}
@@ -47,3 +60,56 @@ func (s *sourceRemote) connection() (io.ReadWriteCloser, error) {
 	}
 	return conn, nil
 }
+
+// bindContext ties the lifetime of conn to ctx. The context's deadline
+// becomes the socket deadline, and cancelling the context expires the
+// deadline so that any blocked read or write returns immediately.
+// The socket is left open: it may be on loan from a Session, and only
+// the query it is lent to may give it back.
+//
+// The returned function detaches conn from ctx and must be called
+// once the exchange is over. It reports false if the context was done
+// first, in which case the deadline it set has taken effect by the
+// time it returns.
+func bindContext(ctx context.Context, conn net.Conn) (release func() bool) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+		close(interrupted)
+	})
+	return func() bool {
+		if stop() {
+			return true
+		}
+		<-interrupted
+		return false
+	}
+}
+
+// contextErr translates an error from a socket bound with bindContext
+// into the error reported to callers. Expired deadlines become Timeout,
+// unless they cut a split response short, cancellation becomes the
+// context's error.
+func contextErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch ctx.Err() {
+	case nil:
+	case context.DeadlineExceeded:
+		if err == PacketMissing {
+			// more telling than a plain Timeout
+			return err
+		}
+		return Timeout
+	default:
+		return ctx.Err()
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return Timeout
+	}
+	return err
+}